@@ -0,0 +1,474 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/corelayer/go-registry/pkg/registry"
+	"gopkg.in/yaml.v3"
+)
+
+func runAdd(o *options, args []string, stdout io.Writer) error {
+	var (
+		err      error
+		document map[string]any
+	)
+
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("expected a path and an optional input file")
+	}
+	input := "-"
+	if len(args) == 2 {
+		input = args[1]
+	}
+
+	if document, err = readDocument(input); err != nil {
+		return err
+	}
+
+	return o.update(func(r *registry.Registry) error {
+		_, err := r.Get(args[0])
+		if err == nil {
+			segments, _ := registry.ParsePath(args[0])
+			return registry.NewItemAlreadyExistsError("item", segments[len(segments)-1])
+		} else if !errors.Is(err, registry.ErrNotFound) {
+			return err
+		}
+
+		*r, err = r.Set(args[0], document)
+		return err
+	})
+}
+
+func runAuditVerify(o *options, args []string, stdout io.Writer) error {
+	var (
+		err     error
+		a       *registry.AuditLog
+		entries uint64
+	)
+
+	if len(args) > 1 {
+		return fmt.Errorf("expected an optional audit log")
+	}
+	path := o.auditLog
+	if len(args) == 1 {
+		path = args[0]
+	}
+	if path == "" {
+		return fmt.Errorf("expected an audit log, pass it as argument or with --audit-log")
+	}
+
+	o.auditLog = path
+	if a, err = o.audit(); err != nil {
+		return err
+	}
+	if entries, err = a.Verify(); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "%s is intact, %d entries verified\n", path, entries)
+	return err
+}
+
+func runDecrypt(o *options, args []string, stdout io.Writer) error {
+	var (
+		err  error
+		r    registry.Registry
+		data []byte
+	)
+
+	if len(args) != 0 {
+		return fmt.Errorf("unexpected arguments")
+	}
+	if o.out == "" && !o.reveal {
+		return fmt.Errorf("decrypting to stdout prints secrets, pass --reveal or write to a file with --out")
+	}
+
+	if r, err = o.load(); err != nil {
+		return err
+	}
+	if err = o.recordReveal(r, ""); err != nil {
+		return err
+	}
+	if o.out == "" {
+		return o.print(stdout, r)
+	}
+
+	if registry.DetectFormat(o.out, nil) == registry.FormatJson {
+		data, err = json.MarshalIndent(r, "", "  ")
+	} else {
+		data, err = yaml.Marshal(r)
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(o.out, data, registry.DefaultFileMode)
+}
+
+func runDiff(o *options, args []string, stdout io.Writer) error {
+	var (
+		err     error
+		key     string
+		changes registry.Changes
+		data    []byte
+	)
+
+	if len(args) != 2 {
+		return fmt.Errorf("expected two registry files")
+	}
+	if key, err = o.getKey(); err != nil {
+		return err
+	}
+	if changes, err = registry.DiffFiles(args[0], args[1], registry.NewKeyring(key)); err != nil {
+		return err
+	}
+
+	switch o.output {
+	case "text":
+		_, err = io.WriteString(stdout, changes.String())
+		return err
+	case "json":
+		if data, err = changes.JSON(); err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(stdout, string(data))
+		return err
+	default:
+		return fmt.Errorf("invalid output format %s", o.output)
+	}
+}
+
+func runEncrypt(o *options, args []string, stdout io.Writer) error {
+	var (
+		err  error
+		data []byte
+		r    registry.Registry
+		key  string
+		l    registry.Loader
+	)
+
+	if len(args) != 1 {
+		return fmt.Errorf("expected the plain registry file to encrypt")
+	}
+
+	if data, err = os.ReadFile(args[0]); err != nil {
+		return err
+	}
+	if registry.DetectFormat(args[0], data) == registry.FormatJson {
+		err = json.Unmarshal(data, &r)
+	} else {
+		err = yaml.Unmarshal(data, &r)
+	}
+	if err != nil {
+		return fmt.Errorf("could not parse registry file %s: %w", args[0], err)
+	}
+
+	if l, err = o.auditedLoader(); err != nil {
+		return err
+	}
+	if len(o.recipients) > 0 {
+		return l.SaveForRecipients(o.recipients, r)
+	}
+	if key, err = o.getKey(); err != nil {
+		return err
+	}
+	return l.Save(key, r)
+}
+
+func runGet(o *options, args []string, stdout io.Writer) error {
+	var (
+		err   error
+		r     registry.Registry
+		value any
+	)
+
+	if len(args) != 1 {
+		return fmt.Errorf("expected a path")
+	}
+	if r, err = o.load(); err != nil {
+		return err
+	}
+	if !o.reveal {
+		r = registry.Redact(r)
+	}
+
+	if value, err = r.Get(args[0]); err != nil {
+		return err
+	}
+	if o.reveal {
+		if err = o.recordReveal(r, args[0]); err != nil {
+			return err
+		}
+	}
+	return o.print(stdout, value)
+}
+
+func runInit(o *options, args []string, stdout io.Writer) error {
+	var (
+		err error
+		key string
+		l   registry.Loader
+	)
+
+	if len(args) != 0 {
+		return fmt.Errorf("unexpected arguments")
+	}
+
+	if _, err = os.Stat(o.file); err == nil {
+		if !o.force {
+			return fmt.Errorf("registry file %s already exists, pass --force to overwrite it", o.file)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	r := registry.NewEmptyRegistry()
+	if o.example {
+		r = registry.NewExampleRegistry()
+	}
+
+	// The existing file is only replaced once the new registry has been encrypted
+	if l, err = o.auditedLoader(); err != nil {
+		return err
+	}
+	if len(o.recipients) > 0 {
+		return l.SaveForRecipients(o.recipients, r)
+	}
+	if key, err = o.getKey(); err != nil {
+		return err
+	}
+	return l.ReplaceWithKeyring(registry.NewKeyring(key), r)
+}
+
+func runList(o *options, args []string, stdout io.Writer) error {
+	var (
+		err   error
+		r     registry.Registry
+		names []string
+	)
+
+	if len(args) > 1 {
+		return fmt.Errorf("expected an optional path")
+	}
+	path := ""
+	if len(args) == 1 {
+		path = args[0]
+	}
+
+	if r, err = o.load(); err != nil {
+		return err
+	}
+	if names, err = r.List(path); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if _, err = fmt.Fprintln(stdout, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runMergeDriver merges the registry files passed by git, the result is written to ours.
+// Conflicting paths keep the value of ours and make the merge fail, so git marks the file as conflicted.
+func runMergeDriver(o *options, args []string, stdout io.Writer) error {
+	var (
+		err       error
+		key       string
+		l         registry.Loader
+		conflicts registry.Conflicts
+	)
+
+	if len(args) != 3 && len(args) != 4 {
+		return fmt.Errorf("expected base, ours and theirs registry files and an optional path")
+	}
+	name := args[1]
+	if len(args) == 4 {
+		name = args[3]
+	}
+
+	if l, err = o.auditedLoader(); err != nil {
+		return err
+	}
+	if key, err = o.getKey(); err != nil {
+		return err
+	}
+	// The result is written to ours, which is the registry file of the loader
+	l.Path = args[1]
+	if conflicts, err = l.MergeThreeWay(args[0], args[2], registry.NewKeyring(key)); err != nil {
+		return fmt.Errorf("could not merge %s: %w", name, err)
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("%d conflicts in %s, ours was kept:\n%w", len(conflicts), name, conflicts)
+	}
+	return nil
+}
+
+func runRemove(o *options, args []string, stdout io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected a path")
+	}
+	return o.update(func(r *registry.Registry) error {
+		var err error
+		*r, err = r.Delete(args[0])
+		return err
+	})
+}
+
+func runRotateKey(o *options, args []string, stdout io.Writer) error {
+	var (
+		err    error
+		oldKey string
+		newKey string
+		repeat string
+	)
+
+	if len(args) != 0 {
+		return fmt.Errorf("unexpected arguments")
+	}
+	if o.identityFile != "" {
+		return fmt.Errorf("the key of a registry encrypted for recipients cannot be rotated, encrypt it for new recipients instead")
+	}
+
+	if oldKey, err = o.getKey(); err != nil {
+		return err
+	}
+
+	if o.newKeyFile != "" {
+		newKey, err = registry.NewFileKeyProvider(o.newKeyFile).GetKey()
+	} else {
+		if newKey, err = registry.NewPromptKeyProvider("New registry key: ").GetKey(); err != nil {
+			return err
+		}
+		if repeat, err = registry.NewPromptKeyProvider("Repeat new registry key: ").GetKey(); err == nil && repeat != newKey {
+			err = fmt.Errorf("keys do not match")
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return o.loader().RotateKey(oldKey, newKey)
+}
+
+// runSet sets the value at a path, the value is read from the terminal if it is not passed, so secrets are not kept in the shell history
+func runSet(o *options, args []string, stdout io.Writer) error {
+	var (
+		err   error
+		data  []byte
+		value string
+	)
+
+	switch {
+	case len(args) == 2 && args[1] == "-":
+		if data, err = io.ReadAll(os.Stdin); err != nil {
+			return err
+		}
+		value = strings.TrimRight(string(data), "\r\n")
+	case len(args) == 2:
+		value = args[1]
+	case len(args) == 1:
+		if value, err = registry.NewPromptKeyProvider("Value for " + args[0] + ": ").GetKey(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("expected a path and a value")
+	}
+
+	return o.update(func(r *registry.Registry) error {
+		var (
+			err      error
+			document map[string]any
+			output   registry.Registry
+		)
+
+		// Items are passed as a json or yaml document, fields as a plain value
+		if yaml.Unmarshal([]byte(value), &document) == nil && document != nil {
+			if output, err = r.Set(args[0], document); err == nil {
+				*r = output
+				return nil
+			}
+		}
+		if output, err = r.Set(args[0], value); err != nil {
+			return err
+		}
+		*r = output
+		return nil
+	})
+}
+
+func runValidate(o *options, args []string, stdout io.Writer) error {
+	var (
+		err      error
+		r        registry.Registry
+		problems registry.ValidationErrors
+	)
+
+	if len(args) != 0 {
+		return fmt.Errorf("unexpected arguments")
+	}
+	if r, err = o.load(); err != nil {
+		return err
+	}
+
+	if err = r.Validate(); err == nil {
+		_, err = fmt.Fprintf(stdout, "%s is valid\n", o.file)
+		return err
+	}
+	if !errors.As(err, &problems) {
+		return err
+	}
+	for _, p := range problems {
+		if _, err = fmt.Fprintln(stdout, p.Error()); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("%d problems found in %s", len(problems), o.file)
+}
+
+// readDocument reads a json or yaml document from a file, or from stdin if the file is -
+func readDocument(input string) (map[string]any, error) {
+	var (
+		err      error
+		data     []byte
+		document map[string]any
+	)
+
+	if input == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(input)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// yaml is a superset of json
+	if err = yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("could not parse document: %w", err)
+	}
+	if document == nil {
+		return nil, fmt.Errorf("empty document")
+	}
+	return document, nil
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+// Command registry manages encrypted registry files
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `Usage: registry <command> [options] [arguments]
+
+Commands:
+  init [--example] [--force]              create a new registry file
+  ls [path]                               list the children of a path
+  get <path>                              print the item or field at a path
+  set <path> <value|->                    set a field, or an item from a json or yaml document
+  add <path> [file|-]                     add an item from a json or yaml document
+  rm <path>                               remove the item at a path
+  encrypt <input>                         encrypt a plain registry file into the registry file
+  decrypt [--out file]                    decrypt the registry file
+  rotate-key [--new-key-file file]        re-encrypt the registry file with a new key
+  validate                                validate the registry file
+  diff <a> <b>                            print the changes between two registry files, as text or json
+  merge-driver <base> <ours> <theirs> [path]
+                                          merge registry files as a git merge driver, the result is written to ours
+  audit-verify [log]                      verify that the audit log was not edited or truncated
+
+Common options:
+  --file path          registry file, defaults to $REGISTRY_FILE or registry.yaml
+  --key-file path      file holding the registry key, the key is read from $REGISTRY_KEY or the terminal otherwise
+  --identity path      age identity file, for registries encrypted for recipients
+  --reveal             print secrets instead of redacting them
+  --output format      output format, yaml or json, text or json for diff
+  --lock-timeout d     time to wait for another process to release the lock on the registry file, defaults to 10s
+  --audit-log path     record changes and revealed secrets in an audit log, defaults to $REGISTRY_AUDIT_LOG
+  --audit-key-file p   file holding the key for the hashes in the audit log, defaults to $REGISTRY_AUDIT_KEY_FILE,
+                       the key must hold at least 16 random bytes and be kept apart from the audit log
+
+Paths start with the organization name, such as acme-corp/netscaler/adc/prod/credentials/nsroot.
+
+To merge registry files with git, add the merge driver to the git configuration:
+  git config merge.registry.name "registry merge driver"
+  git config merge.registry.driver "registry merge-driver --key-file /path/to/key %O %A %B %P"
+and assign it to the registry files in .gitattributes:
+  registry.yaml merge=registry
+`
+
+type command func(o *options, args []string, stdout io.Writer) error
+
+var commands = map[string]command{
+	"init":         runInit,
+	"ls":           runList,
+	"get":          runGet,
+	"set":          runSet,
+	"add":          runAdd,
+	"rm":           runRemove,
+	"encrypt":      runEncrypt,
+	"decrypt":      runDecrypt,
+	"rotate-key":   runRotateKey,
+	"validate":     runValidate,
+	"diff":         runDiff,
+	"merge-driver": runMergeDriver,
+	"audit-verify": runAuditVerify,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		_, _ = fmt.Fprint(stderr, usage)
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+
+	cmd, found := commands[args[0]]
+	if !found {
+		_, _ = fmt.Fprintf(stderr, "unknown command %s\n\n%s", args[0], usage)
+		return 2
+	}
+
+	o := newOptions(args[0], stderr)
+	positional, err := o.parse(args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	if err = cmd(o, positional, stdout); err != nil {
+		_, _ = fmt.Fprintf(stderr, "registry %s: %s\n", args[0], err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/corelayer/go-registry/pkg/registry"
+)
+
+func TestValidateDoesNotPrintSecrets(t *testing.T) {
+	const (
+		key     = "test key"
+		address = "secret address!"
+		email   = "secret-email"
+	)
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "registry.yaml")
+	keyFile := filepath.Join(dir, "key")
+	if err := os.WriteFile(keyFile, []byte(key), 0600); err != nil {
+		t.Fatalf("could not write key file: %v", err)
+	}
+
+	o := registry.NewOrganization("acme")
+	o.Registry.Machines.NetScaler.Adc.Environments = []registry.NetScalerAdcEnvironment{
+		{Name: "prod", Nodes: []registry.NetScalerAdcNode{{Name: "node", Address: address}}},
+	}
+	o.Registry.Certificates.Acme.Users = []registry.AcmeUser{{Name: "user", Email: email}}
+	if err := registry.NewLoader(file).Save(key, registry.Registry{Organizations: []registry.Organization{o}}); err != nil {
+		t.Fatalf("could not save registry: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"validate", "--file", file, "--key-file", keyFile}, &stdout, &stderr); code != 1 {
+		t.Fatalf("validate returned exit code %d, want 1\n%s", code, stderr.String())
+	}
+
+	output := stdout.String() + stderr.String()
+	for _, want := range []string{"nodes[node].address", "users[user].email"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("validate did not report %s:\n%s", want, output)
+		}
+	}
+	for _, secret := range []string{address, email} {
+		if strings.Contains(output, secret) {
+			t.Errorf("validate printed secret value %q:\n%s", secret, output)
+		}
+	}
+}
+
+func TestKeyFileIsNotBypassed(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "registry.yaml")
+	if err := registry.NewLoader(file).Save("test key", registry.NewEmptyRegistry()); err != nil {
+		t.Fatalf("could not save registry: %v", err)
+	}
+	t.Setenv(keyEnvironmentVariable, "test key")
+
+	tests := map[string]string{
+		"missing":     filepath.Join(dir, "missing"),
+		"loose":       filepath.Join(dir, "loose"),
+		"empty":       filepath.Join(dir, "empty"),
+		"a directory": dir,
+	}
+	if err := os.WriteFile(tests["loose"], []byte("test key"), 0644); err != nil {
+		t.Fatalf("could not write key file: %v", err)
+	}
+	if err := os.Chmod(tests["loose"], 0644); err != nil {
+		t.Fatalf("could not change permissions of key file: %v", err)
+	}
+	if err := os.WriteFile(tests["empty"], nil, 0600); err != nil {
+		t.Fatalf("could not write key file: %v", err)
+	}
+	if runtime.GOOS == "windows" {
+		// Windows does not report unix permissions
+		delete(tests, "loose")
+	}
+
+	// The key in the environment must not be used instead of a key file which was given explicitly
+	for name, keyFile := range tests {
+		var stdout, stderr bytes.Buffer
+		if code := run([]string{"ls", "--file", file, "--key-file", keyFile}, &stdout, &stderr); code != 1 {
+			t.Errorf("ls with a key file which is %s returned exit code %d, want 1", name, code)
+		}
+		if !strings.Contains(stderr.String(), "key file") {
+			t.Errorf("ls with a key file which is %s did not report the key file:\n%s", name, stderr.String())
+		}
+	}
+}
@@ -0,0 +1,288 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/corelayer/go-registry/pkg/registry"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	fileEnvironmentVariable     = "REGISTRY_FILE"
+	keyEnvironmentVariable      = "REGISTRY_KEY"
+	auditEnvironmentVariable    = "REGISTRY_AUDIT_LOG"
+	auditKeyEnvironmentVariable = "REGISTRY_AUDIT_KEY_FILE"
+	defaultFile                 = "registry.yaml"
+)
+
+// stringList is a flag which can be passed multiple times
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+type options struct {
+	flags  *flag.FlagSet
+	stderr io.Writer
+
+	file         string
+	keyFile      string
+	identityFile string
+	output       string
+	reveal       bool
+	lockTimeout  time.Duration
+	auditLog     string
+	auditKeyFile string
+
+	example    bool
+	force      bool
+	out        string
+	newKeyFile string
+	recipients stringList
+
+	key string
+}
+
+func newOptions(name string, stderr io.Writer) *options {
+	o := &options{
+		flags:  flag.NewFlagSet("registry "+name, flag.ContinueOnError),
+		stderr: stderr,
+	}
+	o.flags.SetOutput(stderr)
+
+	file := os.Getenv(fileEnvironmentVariable)
+	if file == "" {
+		file = defaultFile
+	}
+	o.flags.StringVar(&o.file, "file", file, "registry file")
+	o.flags.StringVar(&o.keyFile, "key-file", "", "file holding the registry key")
+	o.flags.StringVar(&o.identityFile, "identity", "", "age identity file")
+	output := "yaml"
+	if name == "diff" {
+		output = "text"
+	}
+	o.flags.StringVar(&o.output, "output", output, "output format")
+	o.flags.BoolVar(&o.reveal, "reveal", false, "print secrets instead of redacting them")
+	o.flags.DurationVar(&o.lockTimeout, "lock-timeout", registry.DefaultLockTimeout, "time to wait for the lock on the registry file")
+	o.flags.StringVar(&o.auditLog, "audit-log", os.Getenv(auditEnvironmentVariable), "audit log recording changes and revealed secrets")
+	o.flags.StringVar(&o.auditKeyFile, "audit-key-file", os.Getenv(auditKeyEnvironmentVariable), "file holding the key for the hashes in the audit log")
+
+	switch name {
+	case "init":
+		o.flags.BoolVar(&o.example, "example", false, "create the registry from the example registry")
+		o.flags.BoolVar(&o.force, "force", false, "overwrite an existing registry file")
+		o.flags.Var(&o.recipients, "recipient", "age recipient to encrypt the registry for, can be repeated")
+	case "encrypt":
+		o.flags.Var(&o.recipients, "recipient", "age recipient to encrypt the registry for, can be repeated")
+	case "decrypt":
+		o.flags.StringVar(&o.out, "out", "", "write the decrypted registry to a file instead of stdout")
+	case "rotate-key":
+		o.flags.StringVar(&o.newKeyFile, "new-key-file", "", "file holding the new registry key")
+	}
+	return o
+}
+
+// parse parses the flags, which may be mixed with the positional arguments
+func (o *options) parse(args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := o.flags.Parse(args); err != nil {
+			return nil, err
+		}
+		args = o.flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func (o *options) getKey() (string, error) {
+	if o.key != "" {
+		return o.key, nil
+	}
+
+	// An explicit key file is the only source of the key, the prompt is not a fallback for a key file which cannot be used
+	providers := []registry.KeyProvider{registry.NewFileKeyProvider(o.keyFile)}
+	if o.keyFile == "" {
+		providers = []registry.KeyProvider{
+			registry.NewEnvironmentKeyProvider(keyEnvironmentVariable),
+			registry.NewPromptKeyProvider("Registry key: "),
+		}
+	}
+
+	key, err := registry.NewKeyProviderChain(providers...).GetKey()
+	if err != nil {
+		return "", err
+	}
+	o.key = key
+	return key, nil
+}
+
+func (o *options) getIdentity() (string, error) {
+	data, err := os.ReadFile(o.identityFile)
+	if err != nil {
+		return "", fmt.Errorf("could not read identity file %s: %w", o.identityFile, err)
+	}
+	return string(data), nil
+}
+
+// audit returns the audit log, or nil if no audit log is configured
+func (o *options) audit() (*registry.AuditLog, error) {
+	if o.auditLog == "" {
+		return nil, nil
+	}
+	if o.auditKeyFile == "" {
+		return nil, fmt.Errorf("audit log %s needs a key, pass it with --audit-key-file", o.auditLog)
+	}
+	key, err := registry.NewFileKeyProvider(o.auditKeyFile).GetKey()
+	if err != nil {
+		return nil, fmt.Errorf("could not read audit key: %w", err)
+	}
+	a := registry.NewAuditLog(o.auditLog, []byte(key))
+	a.LockTimeout = o.lockTimeout
+	return &a, nil
+}
+
+// auditedLoader returns a loader which records the changes it saves in the audit log
+func (o *options) auditedLoader() (registry.Loader, error) {
+	var err error
+
+	l := o.loader()
+	l.Audit, err = o.audit()
+	return l, err
+}
+
+func (o *options) loader() registry.Loader {
+	l := registry.NewLoader(o.file)
+	l.LockTimeout = o.lockTimeout
+	return l
+}
+
+// load decrypts the registry file, organizations which cannot be decrypted with the key are reported and skipped
+func (o *options) load() (registry.Registry, error) {
+	var (
+		err      error
+		key      string
+		identity string
+		r        registry.Registry
+		sealed   []string
+	)
+
+	if o.identityFile != "" {
+		if identity, err = o.getIdentity(); err != nil {
+			return registry.Registry{}, err
+		}
+		return o.loader().LoadWithIdentity(identity)
+	}
+
+	if key, err = o.getKey(); err != nil {
+		return registry.Registry{}, err
+	}
+	if r, sealed, err = o.loader().LoadWithKeyring(registry.NewKeyring(key)); err != nil {
+		return registry.Registry{}, err
+	}
+	if len(sealed) > 0 {
+		_, _ = fmt.Fprintf(o.stderr, "warning: organizations %s cannot be decrypted with this key\n", strings.Join(sealed, ", "))
+	}
+	return r, nil
+}
+
+// recordReveal records the secrets at or below path in the audit log, before they are printed or written
+func (o *options) recordReveal(r registry.Registry, path string) error {
+	a, err := o.audit()
+	if err != nil || a == nil {
+		return err
+	}
+	if err = a.RecordReveal(r, path); err != nil {
+		return fmt.Errorf("could not record revealed secrets: %w", err)
+	}
+	return nil
+}
+
+// update changes the registry file with fn, while holding the lock on the registry file
+func (o *options) update(fn func(r *registry.Registry) error) error {
+	var (
+		err      error
+		key      string
+		identity string
+		l        registry.Loader
+	)
+
+	if l, err = o.auditedLoader(); err != nil {
+		return err
+	}
+	if o.identityFile != "" {
+		if identity, err = o.getIdentity(); err != nil {
+			return err
+		}
+		return l.UpdateWithIdentity(identity, fn)
+	}
+
+	// The key is read before taking the lock, so a prompt does not keep other writers waiting
+	if key, err = o.getKey(); err != nil {
+		return err
+	}
+	return l.UpdateWithKeyring(registry.NewKeyring(key), fn)
+}
+
+// print writes scalar values as they are and everything else as a yaml or json document
+func (o *options) print(w io.Writer, v any) error {
+	var (
+		err  error
+		data []byte
+	)
+
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		_, err = fmt.Fprintln(w, v)
+		return err
+	}
+
+	switch o.output {
+	case "json":
+		if data, err = json.MarshalIndent(v, "", "  "); err == nil {
+			data = append(data, '\n')
+		}
+	case "yaml":
+		data, err = yaml.Marshal(v)
+	default:
+		return fmt.Errorf("invalid output format %s", o.output)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
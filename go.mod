@@ -3,13 +3,15 @@ module github.com/corelayer/go-registry
 go 1.23
 
 require (
+	filippo.io/age v1.2.1
 	github.com/bramvdbogaerde/go-scp v1.5.0
 	github.com/corelayer/go-cryptostruct v0.2.1
 	github.com/corelayer/go-netscaleradc-nitro v0.3.5
+	github.com/fsnotify/fsnotify v1.9.0
 	golang.org/x/crypto v0.31.0
+	golang.org/x/sys v0.28.0
+	golang.org/x/term v0.27.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
-require (
-	github.com/minio/sio v0.4.0 // indirect
-	golang.org/x/sys v0.28.0 // indirect
-)
+require github.com/minio/sio v0.4.0 // indirect
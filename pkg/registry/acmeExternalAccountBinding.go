@@ -17,8 +17,6 @@
 package registry
 
 import (
-	"encoding/hex"
-
 	"github.com/corelayer/go-cryptostruct/pkg/cryptostruct"
 )
 
@@ -34,6 +32,10 @@ type AcmeExternalAccountBinding struct {
 	Hmac string `json:"hmac,omitempty" yaml:"hmac,omitempty" mapstructure:"hmac,omitempty" secure:"true"`
 }
 
+func (e AcmeExternalAccountBinding) Encrypt(key string) (SecureAcmeExternalAccountBinding, error) {
+	return encrypt[SecureAcmeExternalAccountBinding](key, DefaultCipherSuite, e)
+}
+
 func (e AcmeExternalAccountBinding) GetTransformConfig() cryptostruct.TransformConfig {
 	return cryptostruct.TransformConfig{
 		Decrypted: AcmeExternalAccountBinding{},
@@ -41,6 +43,21 @@ func (e AcmeExternalAccountBinding) GetTransformConfig() cryptostruct.TransformC
 	}
 }
 
+func (e AcmeExternalAccountBinding) Validate() error {
+	return e.validate("").errorOrNil()
+}
+
+func (e AcmeExternalAccountBinding) validate(path string) ValidationErrors {
+	var errs ValidationErrors
+	if e.Kid == "" && e.Hmac != "" {
+		errs.add(fieldPath(path, "kid"), "kid is required when hmac is set")
+	}
+	if e.Hmac == "" && e.Kid != "" {
+		errs.add(fieldPath(path, "hmac"), "hmac is required when kid is set")
+	}
+	return errs
+}
+
 type SecureAcmeExternalAccountBinding struct {
 	Kid          string                    `json:"kid,omitempty" yaml:"kid,omitempty" mapstructure:"kid,omitempty" secure:"true"`
 	Hmac         string                    `json:"hmac,omitempty" yaml:"hmac,omitempty" mapstructure:"hmac,omitempty" secure:"true"`
@@ -48,15 +65,7 @@ type SecureAcmeExternalAccountBinding struct {
 }
 
 func (s SecureAcmeExternalAccountBinding) Decrypt(key string) (AcmeExternalAccountBinding, error) {
-	var (
-		err       error
-		decrypted any
-	)
-	decrypter := cryptostruct.NewDecrypter(hex.EncodeToString([]byte(key)), s.GetTransformConfig())
-	if decrypted, err = decrypter.Transform(s); err != nil {
-		return AcmeExternalAccountBinding{}, err
-	}
-	return decrypted.(AcmeExternalAccountBinding), nil
+	return decrypt[AcmeExternalAccountBinding](key, s)
 }
 
 func (s SecureAcmeExternalAccountBinding) GetCryptoParams() cryptostruct.CryptoParams {
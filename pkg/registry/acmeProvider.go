@@ -22,6 +22,12 @@ import (
 	"github.com/corelayer/go-cryptostruct/pkg/cryptostruct"
 )
 
+const (
+	AcmeChallengeHttp01    = "http-01"
+	AcmeChallengeDns01     = "dns-01"
+	AcmeChallengeTlsAlpn01 = "tls-alpn-01"
+)
+
 func NewAcmeProvider(name string, pType string, challenge string, variables []AcmeVariable) AcmeProvider {
 	return AcmeProvider{
 		Name:      name,
@@ -32,15 +38,21 @@ func NewAcmeProvider(name string, pType string, challenge string, variables []Ac
 }
 
 type AcmeProvider struct {
-	Name      string         `json:"name,omitempty" yaml:"name,omitempty" mapstructure:"name,omitempty" secure:"false"`
-	Type      string         `json:"type,omitempty" yaml:"type,omitempty" mapstructure:"type,omitempty" secure:"false"`
-	Challenge string         `json:"challenge,omitempty" yaml:"challenge,omitempty" mapstructure:"challenge,omitempty" secure:"false"`
-	Variables []AcmeVariable `json:"variables,omitempty" yaml:"variables,omitempty" mapstructure:"variables,omitempty" secure:"true"`
+	Name        string            `json:"name,omitempty" yaml:"name,omitempty" mapstructure:"name,omitempty" secure:"false"`
+	Labels      map[string]string `json:"labels,omitempty" yaml:"labels,omitempty" mapstructure:"labels,omitempty" secure:"false"`
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty" mapstructure:"annotations,omitempty" secure:"false"`
+	Type        string            `json:"type,omitempty" yaml:"type,omitempty" mapstructure:"type,omitempty" secure:"false"`
+	Challenge   string            `json:"challenge,omitempty" yaml:"challenge,omitempty" mapstructure:"challenge,omitempty" secure:"false"`
+	Variables   []AcmeVariable    `json:"variables,omitempty" yaml:"variables,omitempty" mapstructure:"variables,omitempty" secure:"true"`
 }
 
-func (p AcmeProvider) AddVariable(variable AcmeVariable) AcmeProvider {
-	p.Variables = append(p.Variables, variable)
-	return p
+func (p AcmeProvider) AddVariable(variable AcmeVariable) (AcmeProvider, error) {
+	variables, err := addItem(p.Variables, variable, "acme variable", p.path())
+	if err != nil {
+		return p, err
+	}
+	p.Variables = variables
+	return p, nil
 }
 
 func (p AcmeProvider) ApplyEnvironmentVariables() error {
@@ -52,6 +64,10 @@ func (p AcmeProvider) ApplyEnvironmentVariables() error {
 	return nil
 }
 
+func (p AcmeProvider) Encrypt(key string) (SecureAcmeProvider, error) {
+	return encrypt[SecureAcmeProvider](key, DefaultCipherSuite, p)
+}
+
 func (p AcmeProvider) GetTransformConfig() cryptostruct.TransformConfig {
 	return cryptostruct.TransformConfig{
 		Decrypted: AcmeProvider{},
@@ -59,6 +75,15 @@ func (p AcmeProvider) GetTransformConfig() cryptostruct.TransformConfig {
 	}
 }
 
+func (p AcmeProvider) RemoveVariable(key string) (AcmeProvider, error) {
+	variables, err := removeItem(p.Variables, key, "acme variable", p.path())
+	if err != nil {
+		return p, err
+	}
+	p.Variables = variables
+	return p, nil
+}
+
 func (p AcmeProvider) ResetEnvironmentVariables() error {
 	for _, v := range p.Variables {
 		if err := os.Unsetenv(v.Key); err != nil {
@@ -68,8 +93,57 @@ func (p AcmeProvider) ResetEnvironmentVariables() error {
 	return nil
 }
 
+func (p AcmeProvider) UpdateVariable(variable AcmeVariable) (AcmeProvider, error) {
+	variables, err := updateItem(p.Variables, variable, "acme variable", p.path())
+	if err != nil {
+		return p, err
+	}
+	p.Variables = variables
+	return p, nil
+}
+
+func (p AcmeProvider) UpsertVariable(variable AcmeVariable) AcmeProvider {
+	p.Variables = upsertItem(p.Variables, variable)
+	return p
+}
+
+func (p AcmeProvider) Validate() error {
+	return p.validate("").errorOrNil()
+}
+
+func (p AcmeProvider) itemName() string {
+	return p.Name
+}
+
+// path returns the path of the provider in its collection, used as parent in errors for its variables
+func (p AcmeProvider) path() string {
+	return itemPath("", "providers", p.Name, 0)
+}
+
+func (p AcmeProvider) validate(path string) ValidationErrors {
+	errs := validateLabels(path, p.Labels, p.Annotations)
+	if p.Type == "" {
+		errs.add(fieldPath(path, "type"), "type is required")
+	}
+	switch p.Challenge {
+	case AcmeChallengeHttp01, AcmeChallengeDns01, AcmeChallengeTlsAlpn01:
+	case "":
+		errs.add(fieldPath(path, "challenge"), "challenge is required")
+	default:
+		errs.add(fieldPath(path, "challenge"), "invalid challenge %q, must be one of %s, %s or %s", p.Challenge, AcmeChallengeHttp01, AcmeChallengeDns01, AcmeChallengeTlsAlpn01)
+	}
+
+	errs = append(errs, validateCollection(path, "variables", "key", p.Variables)...)
+	for i, v := range p.Variables {
+		errs = append(errs, v.validate(itemPath(path, "variables", v.Key, i))...)
+	}
+	return errs
+}
+
 type SecureAcmeProvider struct {
 	Name         string                    `json:"name,omitempty" yaml:"name,omitempty" mapstructure:"name,omitempty" secure:"false"`
+	Labels       map[string]string         `json:"labels,omitempty" yaml:"labels,omitempty" mapstructure:"labels,omitempty" secure:"false"`
+	Annotations  map[string]string         `json:"annotations,omitempty" yaml:"annotations,omitempty" mapstructure:"annotations,omitempty" secure:"false"`
 	Type         string                    `json:"type,omitempty" yaml:"type,omitempty" mapstructure:"type,omitempty" secure:"false"`
 	Challenge    string                    `json:"challenge,omitempty" yaml:"challenge,omitempty" mapstructure:"challenge,omitempty" secure:"false"`
 	Variables    []SecureAcmeVariable      `json:"variables,omitempty" yaml:"variables,omitempty" mapstructure:"variables,omitempty" secure:"true"`
@@ -93,6 +167,10 @@ func (p SecureAcmeProvider) ApplyEnvironmentVariables(key string) error {
 	return nil
 }
 
+func (s SecureAcmeProvider) Decrypt(key string) (AcmeProvider, error) {
+	return decrypt[AcmeProvider](key, s)
+}
+
 func (s SecureAcmeProvider) GetCryptoParams() cryptostruct.CryptoParams {
 	return s.CryptoParams
 }
@@ -34,6 +34,37 @@ type AcmeRegistry struct {
 	Providers []AcmeProvider `json:"providers,omitempty" yaml:"providers,omitempty" mapstructure:"providers,omitempty" secure:"true"`
 }
 
+func (r AcmeRegistry) AddProvider(provider AcmeProvider) (AcmeRegistry, error) {
+	providers, err := addItem(r.Providers, provider, "acme provider", "")
+	if err != nil {
+		return r, err
+	}
+	r.Providers = providers
+	return r, nil
+}
+
+func (r AcmeRegistry) AddService(service AcmeService) (AcmeRegistry, error) {
+	services, err := addItem(r.Services, service, "acme service", "")
+	if err != nil {
+		return r, err
+	}
+	r.Services = services
+	return r, nil
+}
+
+func (r AcmeRegistry) AddUser(user AcmeUser) (AcmeRegistry, error) {
+	users, err := addItem(r.Users, user, "acme user", "")
+	if err != nil {
+		return r, err
+	}
+	r.Users = users
+	return r, nil
+}
+
+func (r AcmeRegistry) Encrypt(key string) (SecureAcmeRegistry, error) {
+	return encrypt[SecureAcmeRegistry](key, DefaultCipherSuite, r)
+}
+
 func (r AcmeRegistry) GetProviderByName(name string) (AcmeProvider, error) {
 	for _, p := range r.Providers {
 		if p.Name == name {
@@ -95,6 +126,97 @@ func (r AcmeRegistry) GetUserNames() []string {
 	return names
 }
 
+func (r AcmeRegistry) RemoveProvider(name string) (AcmeRegistry, error) {
+	providers, err := removeItem(r.Providers, name, "acme provider", "")
+	if err != nil {
+		return r, err
+	}
+	r.Providers = providers
+	return r, nil
+}
+
+func (r AcmeRegistry) RemoveService(name string) (AcmeRegistry, error) {
+	services, err := removeItem(r.Services, name, "acme service", "")
+	if err != nil {
+		return r, err
+	}
+	r.Services = services
+	return r, nil
+}
+
+func (r AcmeRegistry) RemoveUser(name string) (AcmeRegistry, error) {
+	users, err := removeItem(r.Users, name, "acme user", "")
+	if err != nil {
+		return r, err
+	}
+	r.Users = users
+	return r, nil
+}
+
+func (r AcmeRegistry) UpdateProvider(provider AcmeProvider) (AcmeRegistry, error) {
+	providers, err := updateItem(r.Providers, provider, "acme provider", "")
+	if err != nil {
+		return r, err
+	}
+	r.Providers = providers
+	return r, nil
+}
+
+func (r AcmeRegistry) UpdateService(service AcmeService) (AcmeRegistry, error) {
+	services, err := updateItem(r.Services, service, "acme service", "")
+	if err != nil {
+		return r, err
+	}
+	r.Services = services
+	return r, nil
+}
+
+func (r AcmeRegistry) UpdateUser(user AcmeUser) (AcmeRegistry, error) {
+	users, err := updateItem(r.Users, user, "acme user", "")
+	if err != nil {
+		return r, err
+	}
+	r.Users = users
+	return r, nil
+}
+
+func (r AcmeRegistry) UpsertProvider(provider AcmeProvider) AcmeRegistry {
+	r.Providers = upsertItem(r.Providers, provider)
+	return r
+}
+
+func (r AcmeRegistry) UpsertService(service AcmeService) AcmeRegistry {
+	r.Services = upsertItem(r.Services, service)
+	return r
+}
+
+func (r AcmeRegistry) UpsertUser(user AcmeUser) AcmeRegistry {
+	r.Users = upsertItem(r.Users, user)
+	return r
+}
+
+func (r AcmeRegistry) Validate() error {
+	return r.validate("").errorOrNil()
+}
+
+func (r AcmeRegistry) validate(path string) ValidationErrors {
+	errs := validateCollection(path, "services", "name", r.Services)
+	for i, s := range r.Services {
+		errs = append(errs, s.validate(itemPath(path, "services", s.Name, i))...)
+	}
+
+	errs = append(errs, validateCollection(path, "users", "name", r.Users)...)
+	for i, u := range r.Users {
+		errs = append(errs, u.validate(itemPath(path, "users", u.Name, i))...)
+	}
+
+	errs = append(errs, validateCollection(path, "providers", "name", r.Providers)...)
+	for i, p := range r.Providers {
+		errs = append(errs, p.validate(itemPath(path, "providers", p.Name, i))...)
+	}
+	return errs
+}
+
 type SecureAcmeRegistry struct {
 	Services     []SecureAcmeService       `json:"services,omitempty" yaml:"services,omitempty" mapstructure:"services,omitempty" secure:"true"`
 	Users        []SecureAcmeUser          `json:"users,omitempty" yaml:"users,omitempty" mapstructure:"users,omitempty" secure:"true"`
@@ -102,6 +224,10 @@ type SecureAcmeRegistry struct {
 	CryptoParams cryptostruct.CryptoParams `json:"cryptoParams" yaml:"cryptoParams" mapstructure:"cryptoParams"`
 }
 
+func (s SecureAcmeRegistry) Decrypt(key string) (AcmeRegistry, error) {
+	return decrypt[AcmeRegistry](key, s)
+}
+
 func (s SecureAcmeRegistry) GetCryptoParams() cryptostruct.CryptoParams {
 	return s.CryptoParams
 }
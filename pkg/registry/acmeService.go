@@ -17,7 +17,7 @@
 package registry
 
 import (
-	"encoding/hex"
+	"net/url"
 
 	"github.com/corelayer/go-cryptostruct/pkg/cryptostruct"
 )
@@ -34,6 +34,10 @@ type AcmeService struct {
 	Url  string `json:"url,omitempty" yaml:"url,omitempty" mapstructure:"url,omitempty" secure:"true"`
 }
 
+func (s AcmeService) Encrypt(key string) (SecureAcmeService, error) {
+	return encrypt[SecureAcmeService](key, DefaultCipherSuite, s)
+}
+
 func (s AcmeService) GetTransformConfig() cryptostruct.TransformConfig {
 	return cryptostruct.TransformConfig{
 		Decrypted: AcmeService{},
@@ -41,6 +45,24 @@ func (s AcmeService) GetTransformConfig() cryptostruct.TransformConfig {
 	}
 }
 
+func (s AcmeService) Validate() error {
+	return s.validate("").errorOrNil()
+}
+
+func (s AcmeService) itemName() string {
+	return s.Name
+}
+
+func (s AcmeService) validate(path string) ValidationErrors {
+	var errs ValidationErrors
+	if s.Url == "" {
+		errs.add(fieldPath(path, "url"), "url is required")
+	} else if u, err := url.Parse(s.Url); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs.add(fieldPath(path, "url"), "url is not a valid http or https url")
+	}
+	return errs
+}
+
 type SecureAcmeService struct {
 	Name         string                    `json:"name,omitempty" yaml:"name,omitempty" mapstructure:"name,omitempty" secure:"false"`
 	Url          string                    `json:"url,omitempty" yaml:"url,omitempty" mapstructure:"url,omitempty" secure:"true"`
@@ -48,15 +70,7 @@ type SecureAcmeService struct {
 }
 
 func (s SecureAcmeService) Decrypt(key string) (AcmeService, error) {
-	var (
-		err       error
-		decrypted any
-	)
-	decrypter := cryptostruct.NewDecrypter(hex.EncodeToString([]byte(key)), s.GetTransformConfig())
-	if decrypted, err = decrypter.Transform(s); err != nil {
-		return AcmeService{}, err
-	}
-	return decrypted.(AcmeService), nil
+	return decrypt[AcmeService](key, s)
 }
 
 func (s SecureAcmeService) GetCryptoParams() cryptostruct.CryptoParams {
@@ -17,7 +17,7 @@
 package registry
 
 import (
-	"encoding/hex"
+	"net/mail"
 
 	"github.com/corelayer/go-cryptostruct/pkg/cryptostruct"
 )
@@ -36,6 +36,10 @@ type AcmeUser struct {
 	ExternalAccountBinding AcmeExternalAccountBinding `json:"eab,omitempty" yaml:"eab,omitempty" mapstructure:"eab,omitempty" secure:"true"`
 }
 
+func (u AcmeUser) Encrypt(key string) (SecureAcmeUser, error) {
+	return encrypt[SecureAcmeUser](key, DefaultCipherSuite, u)
+}
+
 func (u AcmeUser) GetTransformConfig() cryptostruct.TransformConfig {
 	return cryptostruct.TransformConfig{
 		Decrypted: AcmeUser{},
@@ -43,6 +47,24 @@ func (u AcmeUser) GetTransformConfig() cryptostruct.TransformConfig {
 	}
 }
 
+func (u AcmeUser) Validate() error {
+	return u.validate("").errorOrNil()
+}
+
+func (u AcmeUser) itemName() string {
+	return u.Name
+}
+
+func (u AcmeUser) validate(path string) ValidationErrors {
+	var errs ValidationErrors
+	if u.Email == "" {
+		errs.add(fieldPath(path, "email"), "email is required")
+	} else if a, err := mail.ParseAddress(u.Email); err != nil || a.Address != u.Email {
+		errs.add(fieldPath(path, "email"), "email is not a valid email address")
+	}
+	return append(errs, u.ExternalAccountBinding.validate(childPath(path, "eab"))...)
+}
+
 type SecureAcmeUser struct {
 	Name                   string                           `json:"name,omitempty" yaml:"name,omitempty" mapstructure:"name,omitempty" secure:"false"`
 	Email                  string                           `json:"email,omitempty" yaml:"email,omitempty" mapstructure:"email,omitempty" secure:"true"`
@@ -51,15 +73,7 @@ type SecureAcmeUser struct {
 }
 
 func (s SecureAcmeUser) Decrypt(key string) (AcmeUser, error) {
-	var (
-		err       error
-		decrypted any
-	)
-	decrypter := cryptostruct.NewDecrypter(hex.EncodeToString([]byte(key)), s.GetTransformConfig())
-	if decrypted, err = decrypter.Transform(s); err != nil {
-		return AcmeUser{}, err
-	}
-	return decrypted.(AcmeUser), nil
+	return decrypt[AcmeUser](key, s)
 }
 
 func (s SecureAcmeUser) GetCryptoParams() cryptostruct.CryptoParams {
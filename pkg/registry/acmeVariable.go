@@ -17,8 +17,6 @@
 package registry
 
 import (
-	"encoding/hex"
-
 	"github.com/corelayer/go-cryptostruct/pkg/cryptostruct"
 )
 
@@ -34,6 +32,10 @@ type AcmeVariable struct {
 	Value string `json:"value,omitempty" yaml:"value,omitempty" mapstructure:"value,omitempty" secure:"true"`
 }
 
+func (v AcmeVariable) Encrypt(key string) (SecureAcmeVariable, error) {
+	return encrypt[SecureAcmeVariable](key, DefaultCipherSuite, v)
+}
+
 func (v AcmeVariable) GetTransformConfig() cryptostruct.TransformConfig {
 	return cryptostruct.TransformConfig{
 		Decrypted: AcmeVariable{},
@@ -41,6 +43,18 @@ func (v AcmeVariable) GetTransformConfig() cryptostruct.TransformConfig {
 	}
 }
 
+func (v AcmeVariable) Validate() error {
+	return v.validate("").errorOrNil()
+}
+
+func (v AcmeVariable) itemName() string {
+	return v.Key
+}
+
+func (v AcmeVariable) validate(path string) ValidationErrors {
+	return nil
+}
+
 type SecureAcmeVariable struct {
 	Key          string                    `json:"key,omitempty" yaml:"key,omitempty" mapstructure:"key,omitempty" secure:"false"`
 	Value        string                    `json:"value,omitempty" yaml:"value,omitempty" mapstructure:"value,omitempty" secure:"true"`
@@ -48,15 +62,7 @@ type SecureAcmeVariable struct {
 }
 
 func (s SecureAcmeVariable) Decrypt(key string) (AcmeVariable, error) {
-	var (
-		err       error
-		decrypted any
-	)
-	decrypter := cryptostruct.NewDecrypter(hex.EncodeToString([]byte(key)), s.GetTransformConfig())
-	if decrypted, err = decrypter.Transform(s); err != nil {
-		return AcmeVariable{}, err
-	}
-	return decrypted.(AcmeVariable), nil
+	return decrypt[AcmeVariable](key, s)
 }
 
 func (s SecureAcmeVariable) GetCryptoParams() cryptostruct.CryptoParams {
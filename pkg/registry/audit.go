@@ -0,0 +1,390 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"reflect"
+	"time"
+)
+
+type AuditAction string
+
+const (
+	AuditActionAdded    AuditAction = "added"
+	AuditActionRemoved  AuditAction = "removed"
+	AuditActionChanged  AuditAction = "changed"
+	AuditActionRevealed AuditAction = "revealed"
+	AuditActionReplaced AuditAction = "replaced" // The registry file was replaced by contents which cannot be compared with the previous contents
+)
+
+const (
+	MinAuditKeyLength = 16
+
+	auditHeadSuffix = ".head"
+	auditHashPrefix = "hmac-sha256:"
+)
+
+// AuditEntry is a single line of an audit log.
+// Values are never written to the log, changes are recorded with the keyed hashes of the old and new values,
+// so only holders of the audit key can tell whether two entries refer to the same value.
+type AuditEntry struct {
+	Sequence uint64      `json:"sequence" yaml:"sequence"`
+	Time     time.Time   `json:"time" yaml:"time"`
+	Actor    string      `json:"actor" yaml:"actor"`
+	Action   AuditAction `json:"action" yaml:"action"`
+	Path     string      `json:"path" yaml:"path"`
+	Revision uint64      `json:"revision,omitempty" yaml:"revision,omitempty"` // Revision of the registry file which holds the change
+	OldHash  string      `json:"oldHash,omitempty" yaml:"oldHash,omitempty"`
+	NewHash  string      `json:"newHash,omitempty" yaml:"newHash,omitempty"`
+	Previous string      `json:"previous" yaml:"previous"` // Hash of the previous entry, empty for the first entry
+	Hash     string      `json:"hash" yaml:"hash"`         // Keyed hash of this entry, computed with an empty Hash
+}
+
+// auditHead holds the last entry of an audit log, so a truncated log can be detected
+type auditHead struct {
+	Sequence uint64 `json:"sequence"`
+	Hash     string `json:"hash"`
+	Mac      string `json:"mac"` // Keyed hash of the sequence and hash, so the head cannot be rewritten without the audit key
+}
+
+func NewAuditLog(path string, key []byte) AuditLog {
+	return AuditLog{
+		Path:        path,
+		Key:         key,
+		Actor:       currentActor(),
+		LockTimeout: DefaultLockTimeout,
+	}
+}
+
+// AuditLog is an append-only JSONL file which records changes to a registry and secrets which were revealed.
+// Every entry holds the keyed hash of the previous entry, and the last entry is also kept in a head file next to the log,
+// so Verify detects entries which were edited, removed, inserted or truncated by anyone without the audit key.
+type AuditLog struct {
+	Path        string        // Location of the audit log, the head file is stored at Path with .head appended
+	Key         []byte        // Key for the hashes in the log, of at least MinAuditKeyLength random bytes, which is kept apart from the log
+	Actor       string        // Recorded for entries without an actor, defaults to user@host
+	LockTimeout time.Duration // Time to wait for another process to release the lock on the audit log
+}
+
+// Append adds the entries to the log, filling in the sequence, hashes, and the time and actor if they are not set
+func (l AuditLog) Append(entries ...AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	if err := l.checkKey(); err != nil {
+		return err
+	}
+
+	lock, err := lockFile(l.Path, l.LockTimeout)
+	if err != nil {
+		return err
+	}
+	err = l.append(entries)
+	if unlockErr := lock.Unlock(); err == nil {
+		err = unlockErr
+	}
+	return err
+}
+
+// RecordChanges records every change from a to b, b was saved as the given revision of the registry file
+func (l AuditLog) RecordChanges(a Registry, b Registry, revision uint64) error {
+	changes := Diff(a, b)
+	entries := make([]AuditEntry, 0, len(changes))
+	for _, change := range changes {
+		entry := AuditEntry{
+			Action:   AuditAction(change.Type),
+			Path:     change.Path,
+			Revision: revision,
+		}
+		if change.Type != ChangeTypeAdded {
+			entry.OldHash = l.hashValue(lookupValue(a, change.Path))
+		}
+		if change.Type != ChangeTypeRemoved {
+			entry.NewHash = l.hashValue(lookupValue(b, change.Path))
+		}
+		entries = append(entries, entry)
+	}
+	return l.Append(entries...)
+}
+
+// RecordReplaced records that the registry file was replaced by r as the given revision, when its previous contents cannot be decrypted
+func (l AuditLog) RecordReplaced(r Registry, revision uint64) error {
+	return l.Append(AuditEntry{
+		Action:   AuditActionReplaced,
+		Revision: revision,
+		NewHash:  l.hashValue(r),
+	})
+}
+
+// RecordReveal records every secret of the registry at or below path as revealed, such as when the secrets are printed
+func (l AuditLog) RecordReveal(r Registry, path string) error {
+	segments, err := ParsePath(path)
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+	secretPaths(nil, reflect.ValueOf(r.Organizations), false, &paths)
+	entries := make([]AuditEntry, 0)
+	for _, p := range paths {
+		secret, _ := ParsePath(p)
+		if hasPathPrefix(secret, segments) {
+			entries = append(entries, AuditEntry{Action: AuditActionRevealed, Path: p})
+		}
+	}
+	return l.Append(entries...)
+}
+
+// Verify checks the hash chain of the log and compares its last entry with the head file, it returns the number of verified entries.
+// The returned error matches ErrAuditLogTampered if the log was edited or truncated.
+func (l AuditLog) Verify() (uint64, error) {
+	var (
+		err      error
+		data     []byte
+		head     auditHead
+		hasHead  bool
+		previous AuditEntry
+	)
+
+	if err = l.checkKey(); err != nil {
+		return 0, err
+	}
+	if head, hasHead, err = l.readHead(); err != nil {
+		return 0, err
+	}
+	if data, err = os.ReadFile(l.Path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) && !hasHead {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("could not read audit log %s: %w", l.Path, err)
+	}
+
+	line := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		var (
+			entry AuditEntry
+			hash  string
+		)
+
+		line++
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return previous.Sequence, AuditLogError{Path: l.Path, Line: line, Reason: "entry cannot be parsed"}
+		}
+		if hash, err = l.hashEntry(entry); err != nil {
+			return previous.Sequence, err
+		}
+		switch {
+		case !hmac.Equal([]byte(entry.Hash), []byte(hash)):
+			return previous.Sequence, AuditLogError{Path: l.Path, Line: line, Reason: "entry does not match its hash"}
+		case entry.Sequence != previous.Sequence+1:
+			return previous.Sequence, AuditLogError{Path: l.Path, Line: line, Reason: fmt.Sprintf("expected sequence %d, found %d", previous.Sequence+1, entry.Sequence)}
+		case entry.Previous != previous.Hash:
+			return previous.Sequence, AuditLogError{Path: l.Path, Line: line, Reason: "entry does not follow the previous entry"}
+		}
+		previous = entry
+	}
+	if err = scanner.Err(); err != nil {
+		return previous.Sequence, fmt.Errorf("could not read audit log %s: %w", l.Path, err)
+	}
+
+	if !hasHead {
+		if previous.Sequence == 0 {
+			return 0, nil
+		}
+		return previous.Sequence, AuditLogError{Path: l.Path, Reason: "head file is missing"}
+	}
+	if previous.Sequence != head.Sequence || previous.Hash != head.Hash {
+		return previous.Sequence, AuditLogError{Path: l.Path, Reason: fmt.Sprintf("log ends at entry %d, head file is at entry %d", previous.Sequence, head.Sequence)}
+	}
+	return previous.Sequence, nil
+}
+
+// append chains the entries to the head of the log, the lock on the log must be held
+func (l AuditLog) append(entries []AuditEntry) error {
+	var (
+		err     error
+		head    auditHead
+		hasHead bool
+		info    os.FileInfo
+		data    []byte
+		file    *os.File
+	)
+
+	if head, hasHead, err = l.readHead(); err != nil {
+		return err
+	}
+	if !hasHead {
+		// Without the head, the chain cannot be continued from the last entry
+		if info, err = os.Stat(l.Path); err == nil && info.Size() > 0 {
+			return AuditLogError{Path: l.Path, Reason: "head file is missing"}
+		}
+	}
+
+	var lines bytes.Buffer
+	now := time.Now().UTC()
+	for _, entry := range entries {
+		entry.Sequence = head.Sequence + 1
+		entry.Previous = head.Hash
+		if entry.Time.IsZero() {
+			entry.Time = now
+		}
+		entry.Time = entry.Time.UTC()
+		if entry.Actor == "" {
+			entry.Actor = l.Actor
+		}
+		if entry.Hash, err = l.hashEntry(entry); err != nil {
+			return err
+		}
+		if data, err = json.Marshal(entry); err != nil {
+			return err
+		}
+		lines.Write(data)
+		lines.WriteByte('\n')
+		head = auditHead{Sequence: entry.Sequence, Hash: entry.Hash}
+		head.Mac = l.mac([]byte(fmt.Sprintf("%d:%s", head.Sequence, head.Hash)))
+	}
+
+	if file, err = os.OpenFile(l.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, DefaultFileMode); err != nil {
+		return fmt.Errorf("could not open audit log %s: %w", l.Path, err)
+	}
+	if _, err = file.Write(lines.Bytes()); err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("could not write audit log %s: %w", l.Path, err)
+	}
+
+	if data, err = json.Marshal(head); err != nil {
+		return err
+	}
+	if err = writeFileAtomic(l.Path+auditHeadSuffix, data, DefaultFileMode); err != nil {
+		return fmt.Errorf("could not write head file of audit log %s: %w", l.Path, err)
+	}
+	return nil
+}
+
+// readHead returns the contents of the head file, and whether it exists
+func (l AuditLog) readHead() (auditHead, bool, error) {
+	var head auditHead
+
+	data, err := os.ReadFile(l.Path + auditHeadSuffix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return auditHead{}, false, nil
+	}
+	if err != nil {
+		return auditHead{}, false, fmt.Errorf("could not read head file of audit log %s: %w", l.Path, err)
+	}
+	if err = json.Unmarshal(data, &head); err != nil {
+		return auditHead{}, false, AuditLogError{Path: l.Path, Reason: "head file cannot be parsed"}
+	}
+	if !hmac.Equal([]byte(head.Mac), []byte(l.mac([]byte(fmt.Sprintf("%d:%s", head.Sequence, head.Hash))))) {
+		return auditHead{}, false, AuditLogError{Path: l.Path, Reason: "head file does not match its hash"}
+	}
+	return head, true, nil
+}
+
+func (l AuditLog) checkKey() error {
+	if len(l.Key) < MinAuditKeyLength {
+		return fmt.Errorf("audit log %s needs a key of at least %d bytes", l.Path, MinAuditKeyLength)
+	}
+	return nil
+}
+
+// hashEntry returns the keyed hash over all fields of the entry except Hash
+func (l AuditLog) hashEntry(e AuditEntry) (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	return l.mac(data), nil
+}
+
+// hashValue returns the keyed hash of a value, or an empty string if there is no value
+func (l AuditLog) hashValue(v any) string {
+	if v == nil {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return l.mac(data)
+}
+
+func (l AuditLog) mac(data []byte) string {
+	h := hmac.New(sha256.New, l.Key)
+	h.Write(data)
+	return auditHashPrefix + hex.EncodeToString(h.Sum(nil))
+}
+
+// currentActor returns user@host for the user running the process
+func currentActor() string {
+	host, _ := os.Hostname()
+	return currentUser() + "@" + host
+}
+
+// secretPaths collects the paths of the non-empty values tagged secure:"true", secret marks values which are encrypted in a SecureRegistry
+func secretPaths(path []string, v reflect.Value, secret bool, paths *[]string) {
+	switch {
+	case v.Kind() == reflect.Struct:
+		inline := inlinePathFields[v.Type()]
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			name := pathFieldName(field)
+			if name == "" {
+				continue
+			}
+			fieldPath := append(path[:len(path):len(path)], name)
+			if field.Name == inline {
+				fieldPath = path
+			}
+			secretPaths(fieldPath, v.Field(i), field.Tag.Get("secure") == "true", paths)
+		}
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Struct:
+		for i := 0; i < v.Len(); i++ {
+			itemPath := append(path[:len(path):len(path)], itemNameField(v.Index(i)).String())
+			secretPaths(itemPath, v.Index(i), false, paths)
+		}
+	case secret && !isEmptyValue(v):
+		*paths = append(*paths, JoinPath(path...))
+	}
+}
+
+// isEmptyValue reports whether v holds no value, decrypted registries hold empty slices and maps instead of nil
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
@@ -0,0 +1,220 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testAuditKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestAuditLogVerify(t *testing.T) {
+	log := newTestAuditLog(t)
+	count, err := log.Verify()
+	if err != nil {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if count != uint64(len(readAuditLines(t, log))) || count < 4 {
+		t.Errorf("Verify returned %d entries, want one for every line of the log", count)
+	}
+
+	data, err := os.ReadFile(log.Path)
+	if err != nil {
+		t.Fatalf("could not read audit log: %v", err)
+	}
+	if bytes.Contains(data, []byte("a secret")) {
+		t.Errorf("audit log holds a secret value")
+	}
+}
+
+func TestAuditLogVerifyDetectsTampering(t *testing.T) {
+	tests := map[string]func(t *testing.T, log AuditLog){
+		"truncated last entry": func(t *testing.T, log AuditLog) {
+			lines := readAuditLines(t, log)
+			writeAuditLines(t, log, lines[:len(lines)-1])
+		},
+		"truncated to empty": func(t *testing.T, log AuditLog) {
+			writeAuditLines(t, log, nil)
+		},
+		"removed entry": func(t *testing.T, log AuditLog) {
+			lines := readAuditLines(t, log)
+			writeAuditLines(t, log, append(lines[:1], lines[2:]...))
+		},
+		"reordered entries": func(t *testing.T, log AuditLog) {
+			lines := readAuditLines(t, log)
+			lines[1], lines[2] = lines[2], lines[1]
+			writeAuditLines(t, log, lines)
+		},
+		"edited entry": func(t *testing.T, log AuditLog) {
+			lines := readAuditLines(t, log)
+			lines[1] = editAuditLine(t, lines[1], func(entry map[string]any) { entry["actor"] = "someone else" })
+			writeAuditLines(t, log, lines)
+		},
+		"edited entry with unkeyed hash": func(t *testing.T, log AuditLog) {
+			lines := readAuditLines(t, log)
+			lines[1] = editAuditLine(t, lines[1], func(entry map[string]any) {
+				entry["actor"] = "someone else"
+				entry["hash"] = ""
+				data, _ := json.Marshal(entry)
+				sum := sha256.Sum256(data)
+				entry["hash"] = auditHashPrefix + hex.EncodeToString(sum[:])
+			})
+			writeAuditLines(t, log, lines)
+		},
+		"unparsable entry": func(t *testing.T, log AuditLog) {
+			lines := readAuditLines(t, log)
+			lines[0] = lines[0][:len(lines[0])/2]
+			writeAuditLines(t, log, lines)
+		},
+		"removed head file": func(t *testing.T, log AuditLog) {
+			if err := os.Remove(log.Path + auditHeadSuffix); err != nil {
+				t.Fatalf("could not remove head file: %v", err)
+			}
+		},
+		"rewritten head file": func(t *testing.T, log AuditLog) {
+			lines := readAuditLines(t, log)
+			writeAuditLines(t, log, lines[:len(lines)-1])
+			var last AuditEntry
+			if err := json.Unmarshal([]byte(lines[len(lines)-2]), &last); err != nil {
+				t.Fatalf("could not parse audit log entry: %v", err)
+			}
+			data, _ := json.Marshal(auditHead{Sequence: last.Sequence, Hash: last.Hash})
+			if err := os.WriteFile(log.Path+auditHeadSuffix, data, DefaultFileMode); err != nil {
+				t.Fatalf("could not write head file: %v", err)
+			}
+		},
+	}
+
+	for name, tamper := range tests {
+		log := newTestAuditLog(t)
+		tamper(t, log)
+		if _, err := log.Verify(); !errors.Is(err, ErrAuditLogTampered) {
+			t.Errorf("%s: Verify returned %v, want %v", name, err, ErrAuditLogTampered)
+		}
+	}
+
+	// A log which is verified with another key does not match its hashes
+	log := newTestAuditLog(t)
+	log.Key = []byte("another key of at least 16 bytes")
+	if _, err := log.Verify(); !errors.Is(err, ErrAuditLogTampered) {
+		t.Errorf("Verify with another key returned %v, want %v", err, ErrAuditLogTampered)
+	}
+}
+
+func TestAuditLogKey(t *testing.T) {
+	log := NewAuditLog(filepath.Join(t.TempDir(), "audit.jsonl"), []byte("short"))
+	if err := log.RecordReplaced(Registry{}, 1); err == nil {
+		t.Errorf("RecordReplaced with a short key returned no error")
+	}
+	if _, err := log.Verify(); err == nil {
+		t.Errorf("Verify with a short key returned no error")
+	}
+}
+
+func TestLoaderRecordsChanges(t *testing.T) {
+	l, k := newTestLoader(t)
+	log := NewAuditLog(filepath.Join(t.TempDir(), "audit.jsonl"), testAuditKey)
+	l.Audit = &log
+
+	if err := l.SaveWithKeyring(k, Registry{Organizations: []Organization{newTestOrganization("a", "a secret")}}); err != nil {
+		t.Fatalf("SaveWithKeyring returned error: %v", err)
+	}
+	if err := l.UpdateWithKeyring(k, func(r *Registry) error {
+		r.Organizations[0].Registry.Machines.NetScaler.Adc.Environments[0].Credentials[0].Password = "changed"
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateWithKeyring returned error: %v", err)
+	}
+
+	if _, err := log.Verify(); err != nil {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	lines := readAuditLines(t, log)
+	var last AuditEntry
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &last); err != nil {
+		t.Fatalf("could not parse audit log entry: %v", err)
+	}
+	if last.Action != AuditActionChanged || last.Revision != 2 || !strings.HasSuffix(last.Path, "password") {
+		t.Errorf("last audit log entry is %+v, want the changed password at revision 2", last)
+	}
+	if last.OldHash == "" || last.NewHash == "" || last.OldHash == last.NewHash {
+		t.Errorf("last audit log entry does not hold distinct hashes of the old and new password")
+	}
+}
+
+// newTestAuditLog returns an audit log with entries for an added organization, a changed password and a reveal
+func newTestAuditLog(t *testing.T) AuditLog {
+	t.Helper()
+	log := NewAuditLog(filepath.Join(t.TempDir(), "audit.jsonl"), testAuditKey)
+
+	a := Registry{Organizations: []Organization{newTestOrganization("a", "a secret")}}
+	b := cloneValue(reflect.ValueOf(a)).Interface().(Registry)
+	b.Organizations[0].Registry.Machines.NetScaler.Adc.Environments[0].Credentials[0].Password = "changed"
+	if err := log.RecordChanges(Registry{}, a, 1); err != nil {
+		t.Fatalf("RecordChanges returned error: %v", err)
+	}
+	if err := log.RecordChanges(a, b, 2); err != nil {
+		t.Fatalf("RecordChanges returned error: %v", err)
+	}
+	if err := log.RecordReveal(b, "a"); err != nil {
+		t.Fatalf("RecordReveal returned error: %v", err)
+	}
+	return log
+}
+
+func readAuditLines(t *testing.T, log AuditLog) []string {
+	t.Helper()
+	data, err := os.ReadFile(log.Path)
+	if err != nil {
+		t.Fatalf("could not read audit log: %v", err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func writeAuditLines(t *testing.T, log AuditLog, lines []string) {
+	t.Helper()
+	data := strings.Join(lines, "\n")
+	if len(lines) > 0 {
+		data += "\n"
+	}
+	if err := os.WriteFile(log.Path, []byte(data), DefaultFileMode); err != nil {
+		t.Fatalf("could not write audit log: %v", err)
+	}
+}
+
+func editAuditLine(t *testing.T, line string, fn func(entry map[string]any)) string {
+	t.Helper()
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		t.Fatalf("could not parse audit log entry: %v", err)
+	}
+	fn(entry)
+	data, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatalf("could not serialize audit log entry: %v", err)
+	}
+	return string(data)
+}
@@ -0,0 +1,215 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/corelayer/go-cryptostruct/pkg/cryptostruct"
+)
+
+var cryptoParamsType = reflect.TypeOf(cryptostruct.CryptoParams{})
+
+// Sorted returns a copy of the registry with all collections sorted by name, or by key for acme variables
+func (r Registry) Sorted() Registry {
+	return sortCollections(reflect.ValueOf(r)).Interface().(Registry)
+}
+
+// ResealCanonical encrypts the registry with the keyring like Reseal, but produces a stable result to keep diffs small:
+//   - collections are sorted by name
+//   - the key derivation parameters are kept as long as the keyring still unlocks them
+//   - items which decrypt to the same values as in s keep their ciphertext and CryptoParams
+//
+// Only the items which were added or changed since s get new ciphertext.
+// Like Reseal, an organization in r which is sealed in s for the keyring is not replaced.
+func (s SecureRegistry) ResealCanonical(r Registry, k Keyring) (SecureRegistry, error) {
+	cipherSuite := s.CryptoParams.CipherSuite
+	if cipherSuite == "" {
+		cipherSuite = DefaultCipherSuite
+	}
+	return s.resealCanonical(r, k, cipherSuite)
+}
+
+func (s SecureRegistry) resealCanonical(r Registry, k Keyring, cipherSuite string) (SecureRegistry, error) {
+	var (
+		err        error
+		output     SecureRegistry
+		previous   Registry
+		sealed     []string
+		decryptErr error
+	)
+
+	// Without the previous contents there is no ciphertext to reuse, and the sealed organizations must be checked one by one
+	if previous, sealed, decryptErr = s.DecryptWithKeyring(k); decryptErr == nil {
+		err = checkSealedNames(r, sealed)
+	} else {
+		err = s.checkSealed(r, k)
+	}
+	if err != nil {
+		return SecureRegistry{}, err
+	}
+
+	// The encrypted collections hold their items in the order of the sorted registry
+	r = r.Sorted()
+	if output, err = s.reseal(r, k, cipherSuite, true); err != nil {
+		return SecureRegistry{}, err
+	}
+	if s.CryptoParams.CipherSuite == output.CryptoParams.CipherSuite {
+		output.CryptoParams = s.CryptoParams
+	}
+	sort.SliceStable(output.Organizations, func(i, j int) bool {
+		return output.Organizations[i].Name < output.Organizations[j].Name
+	})
+	sort.SliceStable(output.OrganizationKeys, func(i, j int) bool {
+		return output.OrganizationKeys[i].Organization < output.OrganizationKeys[j].Organization
+	})
+
+	if decryptErr != nil {
+		return output, nil
+	}
+
+	for i, o := range output.Organizations {
+		var (
+			existing SecureOrganization
+			current  Organization
+			old      Organization
+		)
+
+		// Sealed organizations are kept as they are
+		if current, err = r.GetOrganizationByName(o.Name); err != nil {
+			continue
+		}
+		if old, err = previous.GetOrganizationByName(o.Name); err != nil || !output.hasSameOrganizationKey(s, o.Name) {
+			continue
+		}
+		existing, _ = s.GetOrganizationByName(o.Name)
+		output.Organizations[i] = reuseCiphertext(reflect.ValueOf(o), reflect.ValueOf(existing), reflect.ValueOf(current), reflect.ValueOf(old)).Interface().(SecureOrganization)
+	}
+	return output, nil
+}
+
+// hasSameOrganizationKey reports whether an organization is encrypted with the same derived key in s and previous
+func (s SecureRegistry) hasSameOrganizationKey(previous SecureRegistry, name string) bool {
+	current, hasOwnKey := s.GetOrganizationKey(name)
+	old, hadOwnKey := previous.GetOrganizationKey(name)
+	if hasOwnKey != hadOwnKey {
+		return false
+	}
+	if hasOwnKey {
+		return current.KeyCheck != "" && current.KeyCheck == old.KeyCheck
+	}
+	return s.KeyCheck != "" && s.KeyCheck == previous.KeyCheck
+}
+
+// reuseCiphertext returns encrypted, with the ciphertext and CryptoParams of existing for every item whose encrypted fields
+// decrypt to the same values. Current and previous are the decrypted values of encrypted and existing.
+// Nested items have CryptoParams of their own, so they are reused independently of their parent.
+func reuseCiphertext(encrypted reflect.Value, existing reflect.Value, current reflect.Value, previous reflect.Value) reflect.Value {
+	if !existing.IsValid() || !isSecureItem(encrypted.Type()) {
+		return encrypted
+	}
+
+	output := reflect.New(encrypted.Type()).Elem()
+	output.Set(encrypted)
+
+	unchanged := existing.FieldByName("CryptoParams").FieldByName("CipherSuite").String() == encrypted.FieldByName("CryptoParams").FieldByName("CipherSuite").String()
+	var ciphertext []int
+	for i := 0; i < encrypted.NumField(); i++ {
+		field := encrypted.Type().Field(i)
+		if field.Type == cryptoParamsType || field.Tag.Get("secure") != "true" {
+			continue
+		}
+
+		switch {
+		case isSecureItem(field.Type):
+			output.Field(i).Set(reuseCiphertext(encrypted.Field(i), existing.Field(i), current.FieldByName(field.Name), previous.FieldByName(field.Name)))
+		case field.Type.Kind() == reflect.Slice && isSecureItem(field.Type.Elem()):
+			output.Field(i).Set(reuseCollectionCiphertext(encrypted.Field(i), existing.Field(i), current.FieldByName(field.Name), previous.FieldByName(field.Name)))
+		default:
+			ciphertext = append(ciphertext, i)
+			if !isEqualValue(current.FieldByName(field.Name), previous.FieldByName(field.Name)) {
+				unchanged = false
+			}
+		}
+	}
+
+	// The ciphertext of the fields is only valid together with the CryptoParams it was encrypted with
+	if unchanged {
+		output.FieldByName("CryptoParams").Set(existing.FieldByName("CryptoParams"))
+		for _, i := range ciphertext {
+			output.Field(i).Set(existing.Field(i))
+		}
+	}
+	return output
+}
+
+func reuseCollectionCiphertext(encrypted reflect.Value, existing reflect.Value, current reflect.Value, previous reflect.Value) reflect.Value {
+	// Encrypted collections hold their items in the same order as the decrypted collections
+	existingItems := make(map[string]int, previous.Len())
+	for i := 0; i < previous.Len() && i < existing.Len(); i++ {
+		existingItems[itemNameField(previous.Index(i)).String()] = i
+	}
+
+	output := reflect.MakeSlice(encrypted.Type(), encrypted.Len(), encrypted.Len())
+	for i := 0; i < encrypted.Len(); i++ {
+		j, found := existingItems[itemNameField(current.Index(i)).String()]
+		if !found {
+			output.Index(i).Set(encrypted.Index(i))
+			continue
+		}
+		output.Index(i).Set(reuseCiphertext(encrypted.Index(i), existing.Index(j), current.Index(i), previous.Index(j)))
+	}
+	return output
+}
+
+// isSecureItem reports whether t is the encrypted form of an item, which holds CryptoParams of its own
+func isSecureItem(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	field, found := t.FieldByName("CryptoParams")
+	return found && field.Type == cryptoParamsType
+}
+
+// sortCollections returns a copy of v with all collections of items sorted by their name
+func sortCollections(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Struct:
+		output := reflect.New(v.Type()).Elem()
+		output.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				output.Field(i).Set(sortCollections(v.Field(i)))
+			}
+		}
+		return output
+	case reflect.Slice:
+		if v.IsNil() || v.Type().Elem().Kind() != reflect.Struct || !itemNameField(reflect.Zero(v.Type().Elem())).IsValid() {
+			return v
+		}
+		output := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			output.Index(i).Set(sortCollections(v.Index(i)))
+		}
+		sort.SliceStable(output.Interface(), func(i, j int) bool {
+			return itemNameField(output.Index(i)).String() < itemNameField(output.Index(j)).String()
+		})
+		return output
+	}
+	return v
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestCanonicalSaveKeepsCiphertext(t *testing.T) {
+	l, k := newTestLoader(t)
+	a := newTestOrganization("a", "a secret")
+	a.Registry.Machines.NetScaler.Adc.Environments[0].Credentials = append(
+		a.Registry.Machines.NetScaler.Adc.Environments[0].Credentials,
+		NetScalerAdcCredential{Name: "api", Username: "api", Password: "api secret"},
+	)
+	// Collections are saved sorted by name, whatever their order in the registry
+	if err := l.SaveWithKeyring(k, Registry{Organizations: []Organization{newTestOrganization("b", "b secret"), a}}); err != nil {
+		t.Fatalf("SaveWithKeyring returned error: %v", err)
+	}
+	first, err := l.LoadSecure()
+	if err != nil {
+		t.Fatalf("LoadSecure returned error: %v", err)
+	}
+	if names := first.GetOrganizationNames(); !slices.Equal(names, []string{"a", "b"}) {
+		t.Errorf("registry file holds organizations %v, want [a b]", names)
+	}
+	credentials := first.Organizations[0].Registry.Machines.NetScaler.Adc.Environments[0].Credentials
+	if len(credentials) != 2 || credentials[0].Name != "api" || credentials[1].Name != "nsroot" {
+		t.Errorf("registry file holds unsorted credentials")
+	}
+
+	// Saving the same registry again only changes the revision
+	r, _, err := l.LoadWithKeyring(k)
+	if err != nil {
+		t.Fatalf("LoadWithKeyring returned error: %v", err)
+	}
+	if err = l.SaveWithKeyring(k, r); err != nil {
+		t.Fatalf("SaveWithKeyring returned error: %v", err)
+	}
+	second, err := l.LoadSecure()
+	if err != nil {
+		t.Fatalf("LoadSecure returned error: %v", err)
+	}
+	if second.Revision != first.Revision+1 {
+		t.Errorf("registry file is at revision %d, want %d", second.Revision, first.Revision+1)
+	}
+	second.Revision = first.Revision
+	if !reflect.DeepEqual(second, first) {
+		t.Errorf("saving an unchanged registry changed the registry file")
+	}
+
+	// Changing one password only gives that credential new ciphertext
+	r.Organizations[0].Registry.Machines.NetScaler.Adc.Environments[0].Credentials[1].Password = "changed"
+	if err = l.SaveWithKeyring(k, r); err != nil {
+		t.Fatalf("SaveWithKeyring returned error: %v", err)
+	}
+	third, err := l.LoadSecure()
+	if err != nil {
+		t.Fatalf("LoadSecure returned error: %v", err)
+	}
+
+	before := first.Organizations[0].Registry.Machines.NetScaler.Adc.Environments[0].Credentials
+	after := third.Organizations[0].Registry.Machines.NetScaler.Adc.Environments[0].Credentials
+	if !reflect.DeepEqual(after[0], before[0]) {
+		t.Errorf("unchanged credential api got new ciphertext")
+	}
+	if after[1].Password == before[1].Password || reflect.DeepEqual(after[1].CryptoParams, before[1].CryptoParams) {
+		t.Errorf("changed credential nsroot kept its ciphertext")
+	}
+	if !reflect.DeepEqual(third.Organizations[1], first.Organizations[1]) {
+		t.Errorf("unchanged organization b got new ciphertext")
+	}
+	if third.KeyCheck != first.KeyCheck || !reflect.DeepEqual(third.KeyDerivation, first.KeyDerivation) {
+		t.Errorf("saving with the same key changed the key derivation parameters")
+	}
+
+	decrypted, _, err := third.DecryptWithKeyring(k)
+	if err != nil {
+		t.Fatalf("DecryptWithKeyring returned error: %v", err)
+	}
+	if !reflect.DeepEqual(decrypted, r) {
+		t.Errorf("registry file decrypts to %+v, want %+v", decrypted, r)
+	}
+}
@@ -17,8 +17,6 @@
 package registry
 
 import (
-	"encoding/hex"
-
 	"github.com/corelayer/go-cryptostruct/pkg/cryptostruct"
 )
 
@@ -34,6 +32,10 @@ type CertificatePassphrase struct {
 	Value string `json:"value,omitempty" yaml:"value,omitempty" mapstructure:"value,omitempty" secure:"true"`
 }
 
+func (c CertificatePassphrase) Encrypt(key string) (SecureCertificatePassphrase, error) {
+	return encrypt[SecureCertificatePassphrase](key, DefaultCipherSuite, c)
+}
+
 func (c CertificatePassphrase) GetTransformConfig() cryptostruct.TransformConfig {
 	return cryptostruct.TransformConfig{
 		Decrypted: CertificatePassphrase{},
@@ -41,6 +43,22 @@ func (c CertificatePassphrase) GetTransformConfig() cryptostruct.TransformConfig
 	}
 }
 
+func (c CertificatePassphrase) Validate() error {
+	return c.validate("").errorOrNil()
+}
+
+func (c CertificatePassphrase) itemName() string {
+	return c.Name
+}
+
+func (c CertificatePassphrase) validate(path string) ValidationErrors {
+	var errs ValidationErrors
+	if c.Value == "" {
+		errs.add(fieldPath(path, "value"), "value is required")
+	}
+	return errs
+}
+
 type SecureCertificatePassphrase struct {
 	Name         string                    `json:"name,omitempty" yaml:"name,omitempty" mapstructure:"name,omitempty" secure:"false"`
 	Value        string                    `json:"value,omitempty" yaml:"value,omitempty" mapstructure:"value,omitempty" secure:"true"`
@@ -48,15 +66,7 @@ type SecureCertificatePassphrase struct {
 }
 
 func (s SecureCertificatePassphrase) Decrypt(key string) (CertificatePassphrase, error) {
-	var (
-		err       error
-		decrypted any
-	)
-	decrypter := cryptostruct.NewDecrypter(hex.EncodeToString([]byte(key)), s.GetTransformConfig())
-	if decrypted, err = decrypter.Transform(s); err != nil {
-		return CertificatePassphrase{}, err
-	}
-	return decrypted.(CertificatePassphrase), nil
+	return decrypt[CertificatePassphrase](key, s)
 }
 
 func (s SecureCertificatePassphrase) GetCryptoParams() cryptostruct.CryptoParams {
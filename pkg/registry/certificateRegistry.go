@@ -32,9 +32,17 @@ type CertificateRegistry struct {
 	Passphrases []CertificatePassphrase `json:"passphrases,omitempty" yaml:"passphrases,omitempty" mapstructure:"passphrases,omitempty" secure:"true"`
 }
 
-func (r CertificateRegistry) AddPassphrase(passphrase CertificatePassphrase) CertificateRegistry {
-	r.Passphrases = append(r.Passphrases, passphrase)
-	return r
+func (r CertificateRegistry) AddPassphrase(passphrase CertificatePassphrase) (CertificateRegistry, error) {
+	passphrases, err := addItem(r.Passphrases, passphrase, "passphrase", "")
+	if err != nil {
+		return r, err
+	}
+	r.Passphrases = passphrases
+	return r, nil
+}
+
+func (r CertificateRegistry) Encrypt(key string) (SecureCertificateRegistry, error) {
+	return encrypt[SecureCertificateRegistry](key, DefaultCipherSuite, r)
 }
 
 func (r CertificateRegistry) GetPassphraseByName(name string) (CertificatePassphrase, error) {
@@ -61,12 +69,52 @@ func (r CertificateRegistry) GetTransformConfig() cryptostruct.TransformConfig {
 	}
 }
 
+func (r CertificateRegistry) RemovePassphrase(name string) (CertificateRegistry, error) {
+	passphrases, err := removeItem(r.Passphrases, name, "passphrase", "")
+	if err != nil {
+		return r, err
+	}
+	r.Passphrases = passphrases
+	return r, nil
+}
+
+func (r CertificateRegistry) UpdatePassphrase(passphrase CertificatePassphrase) (CertificateRegistry, error) {
+	passphrases, err := updateItem(r.Passphrases, passphrase, "passphrase", "")
+	if err != nil {
+		return r, err
+	}
+	r.Passphrases = passphrases
+	return r, nil
+}
+
+func (r CertificateRegistry) UpsertPassphrase(passphrase CertificatePassphrase) CertificateRegistry {
+	r.Passphrases = upsertItem(r.Passphrases, passphrase)
+	return r
+}
+
+func (r CertificateRegistry) Validate() error {
+	return r.validate("").errorOrNil()
+}
+
+func (r CertificateRegistry) validate(path string) ValidationErrors {
+	errs := r.Acme.validate(childPath(path, "acme"))
+	errs = append(errs, validateCollection(path, "passphrases", "name", r.Passphrases)...)
+	for i, p := range r.Passphrases {
+		errs = append(errs, p.validate(itemPath(path, "passphrases", p.Name, i))...)
+	}
+	return errs
+}
+
 type SecureCertificateRegistry struct {
 	Acme         SecureAcmeRegistry            `json:"acme,omitempty" yaml:"acme,omitempty" mapstructure:"acme,omitempty" secure:"true"`
 	Passphrases  []SecureCertificatePassphrase `json:"passphrases,omitempty" yaml:"passphrases,omitempty" mapstructure:"passphrases,omitempty" secure:"true"`
 	CryptoParams cryptostruct.CryptoParams     `json:"cryptoParams" yaml:"cryptoParams" mapstructure:"cryptoParams"`
 }
 
+func (s SecureCertificateRegistry) Decrypt(key string) (CertificateRegistry, error) {
+	return decrypt[CertificateRegistry](key, s)
+}
+
 func (s SecureCertificateRegistry) GetCryptoParams() cryptostruct.CryptoParams {
 	return s.CryptoParams
 }
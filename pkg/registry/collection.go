@@ -0,0 +1,78 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+// namedItem is implemented by all items which are stored in a collection, identified by their name
+type namedItem interface {
+	itemName() string
+}
+
+// The collection helpers always return a new slice, so the collection of the original value is never modified.
+// Parent is the path of the item holding the collection, which is reported in errors.
+
+func addItem[T namedItem](items []T, item T, itemType string, parent string) ([]T, error) {
+	if indexOfItem(items, item.itemName()) >= 0 {
+		return nil, NewItemAlreadyExistsError(itemType, item.itemName()).WithParent(parent)
+	}
+
+	output := make([]T, 0, len(items)+1)
+	output = append(output, items...)
+	return append(output, item), nil
+}
+
+func updateItem[T namedItem](items []T, item T, itemType string, parent string) ([]T, error) {
+	i := indexOfItem(items, item.itemName())
+	if i < 0 {
+		return nil, NewItemNotFoundError(itemType, item.itemName()).WithParent(parent)
+	}
+
+	output := make([]T, len(items))
+	copy(output, items)
+	output[i] = item
+	return output, nil
+}
+
+func upsertItem[T namedItem](items []T, item T) []T {
+	output := make([]T, len(items), len(items)+1)
+	copy(output, items)
+
+	if i := indexOfItem(items, item.itemName()); i >= 0 {
+		output[i] = item
+		return output
+	}
+	return append(output, item)
+}
+
+func removeItem[T namedItem](items []T, name string, itemType string, parent string) ([]T, error) {
+	i := indexOfItem(items, name)
+	if i < 0 {
+		return nil, NewItemNotFoundError(itemType, name).WithParent(parent)
+	}
+
+	output := make([]T, 0, len(items)-1)
+	output = append(output, items[:i]...)
+	return append(output, items[i+1:]...), nil
+}
+
+func indexOfItem[T namedItem](items []T, name string) int {
+	for i, item := range items {
+		if item.itemName() == name {
+			return i
+		}
+	}
+	return -1
+}
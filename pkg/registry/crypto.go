@@ -0,0 +1,60 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"encoding/hex"
+
+	"github.com/corelayer/go-cryptostruct/pkg/cryptostruct"
+)
+
+const (
+	DefaultCipherSuite = "AES_256_GCM"
+)
+
+// decrypt transforms a Secure* struct into its decrypted counterpart T, using the GetTransformConfig pair of s
+func decrypt[T any](key string, s cryptostruct.DecryptTransformer) (T, error) {
+	var (
+		err       error
+		decrypted any
+		output    T
+	)
+	decrypter := cryptostruct.NewDecrypter(hex.EncodeToString([]byte(key)), s.GetTransformConfig())
+	if decrypted, err = decrypter.Transform(s); err != nil {
+		return output, err
+	}
+	return decrypted.(T), nil
+}
+
+// encrypt transforms a struct into its Secure* counterpart T, using fresh CryptoParams for the given cipher suite
+func encrypt[T any](key string, cipherSuite string, d cryptostruct.EncryptTransformer) (T, error) {
+	var (
+		err       error
+		params    cryptostruct.CryptoParams
+		encrypted any
+		output    T
+	)
+	if params, err = cryptostruct.NewCryptoParams(cipherSuite); err != nil {
+		return output, err
+	}
+
+	encrypter := cryptostruct.NewEncrypter(hex.EncodeToString([]byte(key)), params, d.GetTransformConfig())
+	if encrypted, err = encrypter.Transform(d); err != nil {
+		return output, err
+	}
+	return encrypted.(T), nil
+}
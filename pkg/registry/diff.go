@@ -0,0 +1,240 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+type ChangeType string
+
+const (
+	ChangeTypeAdded   ChangeType = "added"
+	ChangeTypeRemoved ChangeType = "removed"
+	ChangeTypeChanged ChangeType = "changed"
+)
+
+// Change describes a single difference between two registries.
+// Secret values are never included, a change to a secret is reported with Secret set.
+type Change struct {
+	Type   ChangeType `json:"type" yaml:"type"`
+	Path   string     `json:"path" yaml:"path"`
+	Secret bool       `json:"secret,omitempty" yaml:"secret,omitempty"`
+	Old    any        `json:"old,omitempty" yaml:"old,omitempty"`
+	New    any        `json:"new,omitempty" yaml:"new,omitempty"`
+}
+
+func (c Change) String() string {
+	switch c.Type {
+	case ChangeTypeAdded:
+		return "+ " + c.Path
+	case ChangeTypeRemoved:
+		return "- " + c.Path
+	}
+	if c.Secret {
+		return fmt.Sprintf("~ %s: secret changed", c.Path)
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", c.Path, formatChangeValue(c.Old), formatChangeValue(c.New))
+}
+
+type Changes []Change
+
+func (c Changes) JSON() ([]byte, error) {
+	if c == nil {
+		c = Changes{}
+	}
+	return json.MarshalIndent(c, "", "  ")
+}
+
+// String returns the changes as text, with one line per change
+func (c Changes) String() string {
+	var b strings.Builder
+	for _, change := range c {
+		b.WriteString(change.String())
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Diff returns the added, removed and changed items and fields from a to b.
+// Items in collections are matched by name, so the order of the items is ignored.
+// Paths use the syntax of Registry.Get, added and removed items are reported with their secrets redacted.
+func Diff(a Registry, b Registry) Changes {
+	changes := make(Changes, 0)
+	diffValue(nil, reflect.ValueOf(a.Organizations), reflect.ValueOf(b.Organizations), false, &changes)
+	return changes
+}
+
+// DiffFiles decrypts two registry files with the keyring and returns the changes from the first to the second file
+func DiffFiles(a string, b string, k Keyring) (Changes, error) {
+	var (
+		err         error
+		left, right SecureRegistry
+	)
+
+	if left, err = NewLoader(a).LoadSecure(); err != nil {
+		return nil, err
+	}
+	if right, err = NewLoader(b).LoadSecure(); err != nil {
+		return nil, err
+	}
+	return DiffSecure(left, right, k)
+}
+
+// DiffSecure decrypts two registries with the keyring and returns the changes from a to b.
+// All organizations must be decrypted, so sealed organizations are not reported as removed.
+func DiffSecure(a SecureRegistry, b SecureRegistry, k Keyring) (Changes, error) {
+	var (
+		err         error
+		left, right Registry
+	)
+
+	if left, err = decryptAll(a, k); err != nil {
+		return nil, err
+	}
+	if right, err = decryptAll(b, k); err != nil {
+		return nil, err
+	}
+	return Diff(left, right), nil
+}
+
+func decryptAll(s SecureRegistry, k Keyring) (Registry, error) {
+	r, sealed, err := s.DecryptWithKeyring(k)
+	if err != nil {
+		return Registry{}, err
+	}
+	if len(sealed) > 0 {
+		return Registry{}, fmt.Errorf("could not decrypt organizations %s: %w", strings.Join(sealed, ", "), ErrInvalidKey)
+	}
+	return r, nil
+}
+
+// diffValue compares a and b of the same type, secret marks values which are encrypted in a SecureRegistry
+func diffValue(path []string, a reflect.Value, b reflect.Value, secret bool, changes *Changes) {
+	switch a.Kind() {
+	case reflect.Struct:
+		inline := inlinePathFields[a.Type()]
+		for i := 0; i < a.NumField(); i++ {
+			field := a.Type().Field(i)
+			name := pathFieldName(field)
+			if name == "" {
+				continue
+			}
+			fieldPath := append(path[:len(path):len(path)], name)
+			if field.Name == inline {
+				fieldPath = path
+			}
+			diffValue(fieldPath, a.Field(i), b.Field(i), field.Tag.Get("secure") == "true", changes)
+		}
+	case reflect.Slice:
+		if a.Type().Elem().Kind() != reflect.Struct {
+			diffScalar(path, a, b, secret, changes)
+			return
+		}
+		diffCollection(path, a, b, changes)
+	case reflect.Map:
+		diffMap(path, a, b, secret, changes)
+	default:
+		diffScalar(path, a, b, secret, changes)
+	}
+}
+
+func diffCollection(path []string, a reflect.Value, b reflect.Value, changes *Changes) {
+	right := make(map[string]reflect.Value, b.Len())
+	for i := 0; i < b.Len(); i++ {
+		right[itemNameField(b.Index(i)).String()] = b.Index(i)
+	}
+
+	left := make(map[string]bool, a.Len())
+	for i := 0; i < a.Len(); i++ {
+		name := itemNameField(a.Index(i)).String()
+		left[name] = true
+		itemPath := append(path[:len(path):len(path)], name)
+		if item, found := right[name]; found {
+			diffValue(itemPath, a.Index(i), item, false, changes)
+			continue
+		}
+		*changes = append(*changes, Change{Type: ChangeTypeRemoved, Path: JoinPath(itemPath...), Old: redactValue(a.Index(i), false).Interface()})
+	}
+
+	for i := 0; i < b.Len(); i++ {
+		name := itemNameField(b.Index(i)).String()
+		if !left[name] {
+			itemPath := append(path[:len(path):len(path)], name)
+			*changes = append(*changes, Change{Type: ChangeTypeAdded, Path: JoinPath(itemPath...), New: redactValue(b.Index(i), false).Interface()})
+		}
+	}
+}
+
+func diffMap(path []string, a reflect.Value, b reflect.Value, secret bool, changes *Changes) {
+	keys := make(map[string]bool, a.Len()+b.Len())
+	for _, key := range append(a.MapKeys(), b.MapKeys()...) {
+		keys[key.String()] = true
+	}
+
+	for _, key := range sortedKeys(keys) {
+		k := reflect.ValueOf(key)
+		keyPath := append(path[:len(path):len(path)], key)
+		left, right := a.MapIndex(k), b.MapIndex(k)
+		switch {
+		case !left.IsValid():
+			*changes = append(*changes, newChange(ChangeTypeAdded, keyPath, reflect.Value{}, right, secret))
+		case !right.IsValid():
+			*changes = append(*changes, newChange(ChangeTypeRemoved, keyPath, left, reflect.Value{}, secret))
+		default:
+			diffScalar(keyPath, left, right, secret, changes)
+		}
+	}
+}
+
+func diffScalar(path []string, a reflect.Value, b reflect.Value, secret bool, changes *Changes) {
+	// Decrypted registries hold empty slices where loaded registries hold nil slices
+	if a.Kind() == reflect.Slice && a.Len() == 0 && b.Len() == 0 {
+		return
+	}
+	if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+		*changes = append(*changes, newChange(ChangeTypeChanged, path, a, b, secret))
+	}
+}
+
+func newChange(t ChangeType, path []string, a reflect.Value, b reflect.Value, secret bool) Change {
+	output := Change{
+		Type:   t,
+		Path:   JoinPath(path...),
+		Secret: secret,
+	}
+	if secret {
+		return output
+	}
+	if a.IsValid() {
+		output.Old = a.Interface()
+	}
+	if b.IsValid() {
+		output.New = b.Interface()
+	}
+	return output
+}
+
+func formatChangeValue(v any) string {
+	if s, isString := v.(string); isString {
+		return fmt.Sprintf("%q", s)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,202 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+const (
+	envelopeDataKeyLength = 32
+)
+
+// Envelope holds the data key of a registry, wrapped for each of the recipients.
+// The data key is used as the registry passphrase, so recipients can be changed without re-encrypting the registry.
+type Envelope struct {
+	Recipients []string `json:"recipients" yaml:"recipients" mapstructure:"recipients"` // age X25519 public keys
+	DataKey    string   `json:"dataKey" yaml:"dataKey" mapstructure:"dataKey"`          // ASCII armored age ciphertext of the data key
+}
+
+// EncryptForRecipients encrypts the registry with a random data key, which is wrapped for the age recipients
+func (r Registry) EncryptForRecipients(recipients ...string) (SecureRegistry, error) {
+	return SecureRegistry{}.encryptForRecipients(r, recipients, DefaultCipherSuite)
+}
+
+// DecryptWithIdentity unwraps the data key with an age identity and decrypts the registry with it
+func (s SecureRegistry) DecryptWithIdentity(identity string) (Registry, error) {
+	dataKey, err := s.UnwrapDataKey(identity)
+	if err != nil {
+		return Registry{}, err
+	}
+	return s.Decrypt(dataKey)
+}
+
+func (s SecureRegistry) HasEnvelope() bool {
+	return s.Envelope != nil
+}
+
+// SetRecipients wraps the data key for a new set of recipients, leaving the encrypted registry untouched
+func (s SecureRegistry) SetRecipients(identity string, recipients ...string) (SecureRegistry, error) {
+	var (
+		err      error
+		dataKey  string
+		envelope Envelope
+	)
+
+	if dataKey, err = s.UnwrapDataKey(identity); err != nil {
+		return SecureRegistry{}, err
+	}
+	if envelope, err = wrapDataKey(dataKey, recipients); err != nil {
+		return SecureRegistry{}, err
+	}
+
+	s.Envelope = &envelope
+	return s, nil
+}
+
+func (s SecureRegistry) AddRecipient(identity string, recipient string) (SecureRegistry, error) {
+	if !s.HasEnvelope() {
+		return SecureRegistry{}, fmt.Errorf("registry is not encrypted for recipients")
+	}
+
+	recipients := make([]string, 0, len(s.Envelope.Recipients)+1)
+	for _, r := range s.Envelope.Recipients {
+		if r == recipient {
+			return s, nil
+		}
+		recipients = append(recipients, r)
+	}
+	return s.SetRecipients(identity, append(recipients, recipient)...)
+}
+
+func (s SecureRegistry) RemoveRecipient(identity string, recipient string) (SecureRegistry, error) {
+	if !s.HasEnvelope() {
+		return SecureRegistry{}, fmt.Errorf("registry is not encrypted for recipients")
+	}
+
+	recipients := make([]string, 0, len(s.Envelope.Recipients))
+	for _, r := range s.Envelope.Recipients {
+		if r != recipient {
+			recipients = append(recipients, r)
+		}
+	}
+	if len(recipients) == len(s.Envelope.Recipients) {
+		return SecureRegistry{}, NewItemNotFoundError("recipient", recipient)
+	}
+	return s.SetRecipients(identity, recipients...)
+}
+
+// UnwrapDataKey returns the data key of the registry, to be used as the registry passphrase.
+// The identity holds one or more age identities, in the format of an age identity file.
+func (s SecureRegistry) UnwrapDataKey(identity string) (string, error) {
+	var (
+		err        error
+		identities []age.Identity
+		reader     io.Reader
+		dataKey    []byte
+	)
+
+	if !s.HasEnvelope() {
+		return "", fmt.Errorf("registry is not encrypted for recipients")
+	}
+
+	if identities, err = age.ParseIdentities(strings.NewReader(identity)); err != nil {
+		return "", fmt.Errorf("could not parse age identity: %w", err)
+	}
+
+	if reader, err = age.Decrypt(armor.NewReader(strings.NewReader(s.Envelope.DataKey)), identities...); err != nil {
+		return "", fmt.Errorf("could not unwrap data key: %w", ErrInvalidKey)
+	}
+	if dataKey, err = io.ReadAll(reader); err != nil {
+		return "", fmt.Errorf("could not unwrap data key: %w", err)
+	}
+	return string(dataKey), nil
+}
+
+func (s SecureRegistry) encryptForRecipients(r Registry, recipients []string, cipherSuite string) (SecureRegistry, error) {
+	var (
+		err      error
+		key      [envelopeDataKeyLength]byte
+		envelope Envelope
+		output   SecureRegistry
+	)
+
+	if _, err = io.ReadFull(rand.Reader, key[:]); err != nil {
+		return SecureRegistry{}, fmt.Errorf("failed to read random data for data key: %w", err)
+	}
+	dataKey := hex.EncodeToString(key[:])
+
+	if envelope, err = wrapDataKey(dataKey, recipients); err != nil {
+		return SecureRegistry{}, err
+	}
+
+	// The previous envelope does not apply to the new data key
+	s.Envelope = nil
+	if output, err = s.reseal(r, NewKeyring(dataKey), cipherSuite, false); err != nil {
+		return SecureRegistry{}, err
+	}
+	output.Envelope = &envelope
+	return output, nil
+}
+
+func wrapDataKey(dataKey string, recipients []string) (Envelope, error) {
+	var (
+		err       error
+		recipient *age.X25519Recipient
+		writer    io.WriteCloser
+	)
+
+	if len(recipients) == 0 {
+		return Envelope{}, fmt.Errorf("no recipients for data key")
+	}
+
+	parsed := make([]age.Recipient, 0, len(recipients))
+	for _, r := range recipients {
+		if recipient, err = age.ParseX25519Recipient(r); err != nil {
+			return Envelope{}, fmt.Errorf("could not parse age recipient %s: %w", r, err)
+		}
+		parsed = append(parsed, recipient)
+	}
+
+	buffer := new(bytes.Buffer)
+	armorWriter := armor.NewWriter(buffer)
+	if writer, err = age.Encrypt(armorWriter, parsed...); err != nil {
+		return Envelope{}, fmt.Errorf("could not wrap data key: %w", err)
+	}
+	if _, err = io.WriteString(writer, dataKey); err != nil {
+		return Envelope{}, fmt.Errorf("could not wrap data key: %w", err)
+	}
+	if err = writer.Close(); err != nil {
+		return Envelope{}, fmt.Errorf("could not wrap data key: %w", err)
+	}
+	if err = armorWriter.Close(); err != nil {
+		return Envelope{}, fmt.Errorf("could not wrap data key: %w", err)
+	}
+
+	return Envelope{
+		Recipients: append([]string{}, recipients...),
+		DataKey:    buffer.String(),
+	}, nil
+}
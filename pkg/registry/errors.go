@@ -16,26 +16,135 @@
 
 package registry
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
 const (
-	ErrItemNotFoundMessage = "could not find"
+	ErrItemNotFoundMessage      = "could not find"
+	ErrItemAlreadyExistsMessage = "already exists"
+)
+
+var (
+	ErrNotFound                 = errors.New("not found")
+	ErrAlreadyExists            = errors.New("already exists")
+	ErrInvalidKey               = errors.New("invalid key")
+	ErrKeyNotAvailable          = errors.New("key not available")
+	ErrNoPrimaryNode            = errors.New("no primary node")
+	ErrNoManagementNode         = errors.New("no management node")
+	ErrUnsupportedSchemaVersion = errors.New("unsupported schema version")
+	ErrRevisionConflict         = errors.New("revision conflict")
+	ErrLocked                   = errors.New("locked")
+	ErrAuditLogTampered         = errors.New("audit log tampered")
 )
 
 func NewItemNotFoundError(itemType string, name string) ItemNotFoundError {
 	return ItemNotFoundError{
-		itemType: itemType,
-		name:     name,
-		message:  ErrItemNotFoundMessage,
+		ItemType: itemType,
+		Name:     name,
 	}
 }
 
+// ItemNotFoundError is returned when an item cannot be found in a collection, it matches ErrNotFound
 type ItemNotFoundError struct {
-	itemType string
-	name     string
-	message  string
+	ItemType string
+	Name     string
+	Parent   string // Path of the item holding the collection, such as environments[prod], empty for top-level collections
 }
 
 func (e ItemNotFoundError) Error() string {
-	return fmt.Sprintf("%s %s %s", e.message, e.itemType, e.name)
+	if e.Parent == "" {
+		return fmt.Sprintf("%s %s %s", ErrItemNotFoundMessage, e.ItemType, e.Name)
+	}
+	return fmt.Sprintf("%s %s %s in %s", ErrItemNotFoundMessage, e.ItemType, e.Name, e.Parent)
+}
+
+func (e ItemNotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+func (e ItemNotFoundError) WithParent(parent string) ItemNotFoundError {
+	e.Parent = parent
+	return e
+}
+
+func NewItemAlreadyExistsError(itemType string, name string) ItemAlreadyExistsError {
+	return ItemAlreadyExistsError{
+		ItemType: itemType,
+		Name:     name,
+	}
+}
+
+// ItemAlreadyExistsError is returned when an item with the same name is already in a collection, it matches ErrAlreadyExists
+type ItemAlreadyExistsError struct {
+	ItemType string
+	Name     string
+	Parent   string // Path of the item holding the collection, such as environments[prod], empty for top-level collections
+}
+
+func (e ItemAlreadyExistsError) Error() string {
+	if e.Parent == "" {
+		return fmt.Sprintf("%s %s %s", e.ItemType, e.Name, ErrItemAlreadyExistsMessage)
+	}
+	return fmt.Sprintf("%s %s %s in %s", e.ItemType, e.Name, ErrItemAlreadyExistsMessage, e.Parent)
+}
+
+func (e ItemAlreadyExistsError) Is(target error) bool {
+	return target == ErrAlreadyExists
+}
+
+func (e ItemAlreadyExistsError) WithParent(parent string) ItemAlreadyExistsError {
+	e.Parent = parent
+	return e
+}
+
+// RevisionConflictError is returned when a registry file was changed by another writer since it was loaded, it matches ErrRevisionConflict
+type RevisionConflictError struct {
+	Path     string
+	Expected uint64 // Revision the registry was loaded from
+	Actual   uint64 // Revision of the registry file
+}
+
+func (e RevisionConflictError) Error() string {
+	return fmt.Sprintf("registry file %s was changed by another writer, expected revision %d, found revision %d", e.Path, e.Expected, e.Actual)
+}
+
+func (e RevisionConflictError) Is(target error) bool {
+	return target == ErrRevisionConflict
+}
+
+// LockedError is returned when the lock on a registry file is held by another process, it matches ErrLocked
+type LockedError struct {
+	Path   string   // Location of the lock file
+	Holder LockInfo // Process holding the lock, empty if the lock file could not be read
+}
+
+func (e LockedError) Error() string {
+	if e.Holder.Pid == 0 {
+		return fmt.Sprintf("lock file %s is held by another process", e.Path)
+	}
+	return fmt.Sprintf("lock file %s is held by %s", e.Path, e.Holder)
+}
+
+func (e LockedError) Is(target error) bool {
+	return target == ErrLocked
+}
+
+// AuditLogError is returned when an audit log fails verification, it matches ErrAuditLogTampered
+type AuditLogError struct {
+	Path   string
+	Line   int // Line of the offending entry, 0 if the log as a whole does not match its head file
+	Reason string
+}
+
+func (e AuditLogError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("audit log %s is tampered: %s", e.Path, e.Reason)
+	}
+	return fmt.Sprintf("audit log %s is tampered at line %d: %s", e.Path, e.Line, e.Reason)
+}
+
+func (e AuditLogError) Is(target error) bool {
+	return target == ErrAuditLogTampered
 }
@@ -0,0 +1,211 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// itemTypes holds the names of the items which are reported in events
+var itemTypes = map[reflect.Type]string{
+	reflect.TypeOf(Organization{}):            "organization",
+	reflect.TypeOf(NetScalerAdcEnvironment{}): "environment",
+	reflect.TypeOf(NetScalerAdcNode{}):        "node",
+	reflect.TypeOf(NetScalerAdcCredential{}):  "credential",
+	reflect.TypeOf(AcmeService{}):             "acme service",
+	reflect.TypeOf(AcmeUser{}):                "acme user",
+	reflect.TypeOf(AcmeProvider{}):            "acme provider",
+	reflect.TypeOf(AcmeVariable{}):            "acme variable",
+	reflect.TypeOf(CertificatePassphrase{}):   "passphrase",
+	reflect.TypeOf(SmtpServer{}):              "smtp server",
+}
+
+// Event describes a change to an item of the registry, such as an added environment or a changed credential
+type Event struct {
+	Type       ChangeType `json:"type" yaml:"type"`
+	Item       string     `json:"item" yaml:"item"` // Type of the item, such as environment or credential
+	Name       string     `json:"name" yaml:"name"`
+	Path       string     `json:"path" yaml:"path"`
+	ParentItem string     `json:"parentItem,omitempty" yaml:"parentItem,omitempty"` // Type of the item holding the item, empty for organizations
+	ParentName string     `json:"parentName,omitempty" yaml:"parentName,omitempty"`
+	Fields     []string   `json:"fields,omitempty" yaml:"fields,omitempty"` // Changed fields, relative to the path of the item
+	Revision   uint64     `json:"revision" yaml:"revision"`                 // Revision of the registry file which holds the change
+	Before     any        `json:"before,omitempty" yaml:"before,omitempty"` // Item before the change, nil for added items
+	After      any        `json:"after,omitempty" yaml:"after,omitempty"`   // Item after the change, nil for removed items
+}
+
+// String describes the event, such as: credential nsroot in environment prod changed
+func (e Event) String() string {
+	if e.ParentItem == "" {
+		return fmt.Sprintf("%s %s %s", e.Item, e.Name, e.Type)
+	}
+	return fmt.Sprintf("%s %s in %s %s %s", e.Item, e.Name, e.ParentItem, e.ParentName, e.Type)
+}
+
+// redacted returns a copy of the event in which the secrets of the images are redacted
+func (e Event) redacted() Event {
+	e.Before = redactImage(e.Before)
+	e.After = redactImage(e.After)
+	return e
+}
+
+// revealed returns a copy of the event with its own copy of the images, so subscribers cannot modify the registry of the store
+func (e Event) revealed() Event {
+	e.Before = cloneImage(e.Before)
+	e.After = cloneImage(e.After)
+	return e
+}
+
+// EventFilter selects the events a subscriber receives, the zero value selects all events with their secrets redacted
+type EventFilter struct {
+	Items  []string // Types of items, such as environment or credential, all types if empty
+	Paths  []string // Items on or below one of the paths, all items if empty
+	Reveal bool     // Include secrets in the before and after images, instead of redacting them
+}
+
+// Matches reports whether the event is selected by the filter.
+// An added or removed item also matches the paths below it, as everything it holds was added or removed with it.
+func (f EventFilter) Matches(e Event) bool {
+	if len(f.Items) > 0 && !slices.Contains(f.Items, e.Item) {
+		return false
+	}
+	if len(f.Paths) == 0 {
+		return true
+	}
+
+	item, err := ParsePath(e.Path)
+	if err != nil {
+		return false
+	}
+	for _, p := range f.Paths {
+		segments, err := ParsePath(p)
+		if err != nil {
+			continue
+		}
+		if hasPathPrefix(item, segments) || (e.Type != ChangeTypeChanged && hasPathPrefix(segments, item)) {
+			return true
+		}
+	}
+	return false
+}
+
+// newEvents groups the changes from a to b by the item they belong to, with one event per added, removed or changed item
+func newEvents(changes Changes, a Registry, b Registry, revision uint64) []Event {
+	events := make([]Event, 0, len(changes))
+	index := make(map[string]int)
+	for _, change := range changes {
+		// Paths of changes start at the list of organizations
+		root := reflect.ValueOf(b.Organizations)
+		if change.Type == ChangeTypeRemoved {
+			root = reflect.ValueOf(a.Organizations)
+		}
+
+		event, fields, found := describeChange(root, change.Path)
+		if !found {
+			continue
+		}
+		if i, exists := index[event.Path]; exists {
+			events[i].Fields = append(events[i].Fields, fields)
+			continue
+		}
+
+		event.Type = ChangeTypeChanged
+		switch {
+		case fields != "":
+			event.Fields = []string{fields}
+		case change.Type != ChangeTypeChanged:
+			event.Type = change.Type
+		}
+		event.Revision = revision
+		if event.Type != ChangeTypeAdded {
+			event.Before = lookupValue(a, event.Path)
+		}
+		if event.Type != ChangeTypeRemoved {
+			event.After = lookupValue(b, event.Path)
+		}
+		index[event.Path] = len(events)
+		events = append(events, event)
+	}
+	return events
+}
+
+// describeChange returns the event for the innermost item on a path, and the remainder of the path after the item
+func describeChange(root reflect.Value, path string) (Event, string, bool) {
+	segments, err := ParsePath(path)
+	if err != nil {
+		return Event{}, "", false
+	}
+
+	var (
+		event Event
+		found bool
+		item  int
+	)
+	v := root
+	for i, segment := range segments {
+		if !hasChildren(v) {
+			break
+		}
+		child, _, index := lookupSegment(v, segment)
+		if !child.IsValid() {
+			break
+		}
+		if name, isItem := itemTypes[child.Type()]; isItem && index >= 0 {
+			event = Event{
+				Item:       name,
+				Name:       segment,
+				Path:       JoinPath(segments[:i+1]...),
+				ParentItem: event.Item,
+				ParentName: event.Name,
+			}
+			found = true
+			item = i + 1
+		}
+		v = child
+	}
+	return event, JoinPath(segments[item:]...), found
+}
+
+func cloneImage(image any) any {
+	if image == nil {
+		return nil
+	}
+	return cloneValue(reflect.ValueOf(image)).Interface()
+}
+
+// hasPathPrefix reports whether the path segments start with the segments of prefix
+func hasPathPrefix(segments []string, prefix []string) bool {
+	return len(segments) >= len(prefix) && slices.Equal(segments[:len(prefix)], prefix)
+}
+
+// lookupValue returns the item or field at path in the registry, or nil if it does not exist
+func lookupValue(r Registry, path string) any {
+	v, err := resolvePath(reflect.ValueOf(r.Organizations), path, false)
+	if err != nil {
+		return nil
+	}
+	return v.Interface()
+}
+
+func redactImage(image any) any {
+	if image == nil {
+		return nil
+	}
+	return redactValue(reflect.ValueOf(image), false).Interface()
+}
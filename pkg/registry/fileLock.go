@@ -0,0 +1,225 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"time"
+)
+
+const (
+	DefaultLockTimeout = 10 * time.Second
+
+	lockFileSuffix    = ".lock"
+	lockRetryInterval = 100 * time.Millisecond
+)
+
+// LockInfo identifies the process which holds the lock on a registry file, it is written into the lock file
+type LockInfo struct {
+	Pid      int       `json:"pid" yaml:"pid" mapstructure:"pid"`
+	Host     string    `json:"host" yaml:"host" mapstructure:"host"`
+	User     string    `json:"user" yaml:"user" mapstructure:"user"`
+	Acquired time.Time `json:"acquired" yaml:"acquired" mapstructure:"acquired"`
+}
+
+func (i LockInfo) String() string {
+	return fmt.Sprintf("pid %d on %s by %s since %s", i.Pid, i.Host, i.User, i.Acquired.Format(time.RFC3339))
+}
+
+// fileLock is an advisory lock on a registry file, which is held until Unlock is called.
+// The lock is taken with flock on a lock file next to the registry file where the platform and file system support it.
+// Otherwise the lock is held by creating the lock file exclusively, a lock file left behind by a crashed process must then be removed by hand.
+type fileLock struct {
+	path  string
+	file  *os.File
+	flock bool // Whether the lock is held with flock, or by the lock file itself
+}
+
+// UpdateWithKeyring decrypts the registry file with the keyring, runs fn on the registry and saves the result,
+// while holding the lock on the registry file. Nothing is saved if fn returns an error,
+// or if fn added an organization which already exists but is sealed for the keyring.
+// Every save takes the lock on the registry file, so load-modify-save cycles use UpdateWithKeyring or UpdateWithIdentity
+// instead of loading and saving separately. Fn must not save the registry file itself, that would wait for the lock held by the update.
+func (l Loader) UpdateWithKeyring(k Keyring, fn func(r *Registry) error) error {
+	return l.withLock(func() error {
+		r, sealed, err := l.LoadWithKeyring(k)
+		if err != nil {
+			return err
+		}
+		if err = fn(&r); err != nil {
+			return err
+		}
+		// Fail before encrypting anything, instead of overwriting an organization which is sealed for the keyring
+		if err = checkSealedNames(r, sealed); err != nil {
+			return err
+		}
+		_, err = l.saveWithKeyring(k, r, false, 0)
+		return err
+	})
+}
+
+// UpdateWithIdentity decrypts the registry file with an age identity, runs fn on the registry and saves the result,
+// while holding the lock on the registry file. Nothing is saved if fn returns an error.
+func (l Loader) UpdateWithIdentity(identity string, fn func(r *Registry) error) error {
+	return l.withLock(func() error {
+		r, err := l.LoadWithIdentity(identity)
+		if err != nil {
+			return err
+		}
+		if err = fn(&r); err != nil {
+			return err
+		}
+		return l.saveWithIdentity(identity, r)
+	})
+}
+
+// withLock runs fn while holding the lock on the registry file, waiting up to the LockTimeout of the loader for another process to release it.
+// If the lock is still held after the timeout, the returned error matches ErrLocked and reports the holder of the lock.
+// The lock is not reentrant, so fn must not call methods of the loader which take the lock themselves.
+func (l Loader) withLock(fn func() error) error {
+	lock, err := lockFile(l.Path, l.LockTimeout)
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+	if unlockErr := lock.Unlock(); err == nil {
+		err = unlockErr
+	}
+	return err
+}
+
+// Unlock releases the lock and removes the lock file
+func (f *fileLock) Unlock() error {
+	var removeErr, closeErr error
+
+	if f.flock {
+		// The lock file is removed while the lock is still held, so a waiting process never locks a lock file which is about to be removed
+		removeErr = os.Remove(f.path)
+		closeErr = f.file.Close()
+	} else {
+		// Open files cannot be removed on every platform
+		closeErr = f.file.Close()
+		removeErr = os.Remove(f.path)
+	}
+
+	if removeErr != nil && !errors.Is(removeErr, fs.ErrNotExist) {
+		return fmt.Errorf("could not remove lock file %s: %w", f.path, removeErr)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("could not release lock file %s: %w", f.path, closeErr)
+	}
+	return nil
+}
+
+func (f *fileLock) writeInfo(info LockInfo) error {
+	var (
+		err  error
+		data []byte
+	)
+
+	if data, err = json.Marshal(info); err != nil {
+		return err
+	}
+	if err = f.file.Truncate(0); err != nil {
+		return fmt.Errorf("could not write lock file %s: %w", f.path, err)
+	}
+	if _, err = f.file.WriteAt(data, 0); err != nil {
+		return fmt.Errorf("could not write lock file %s: %w", f.path, err)
+	}
+	return nil
+}
+
+// lockFile acquires the lock on the file at path, waiting up to timeout for another process to release it
+func lockFile(path string, timeout time.Duration) (*fileLock, error) {
+	var (
+		err  error
+		lock *fileLock
+	)
+
+	deadline := time.Now().Add(timeout)
+	for {
+		if lock, err = tryLock(path + lockFileSuffix); err == nil {
+			break
+		}
+		if !errors.Is(err, ErrLocked) {
+			return nil, err
+		}
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("could not lock file %s within %s: %w", path, timeout, err)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+
+	if err = lock.writeInfo(newLockInfo()); err != nil {
+		_ = lock.Unlock()
+		return nil, err
+	}
+	return lock, nil
+}
+
+// createLockFile opens the lock file, reporting whether it was created or already existed
+func createLockFile(path string) (*os.File, bool, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, DefaultFileMode)
+	if err == nil {
+		return file, true, nil
+	}
+	if !errors.Is(err, fs.ErrExist) {
+		return nil, false, fmt.Errorf("could not create lock file %s: %w", path, err)
+	}
+
+	if file, err = os.OpenFile(path, os.O_RDWR, DefaultFileMode); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			// The lock file was removed in the meantime
+			return nil, false, newLockedError(path)
+		}
+		return nil, false, fmt.Errorf("could not open lock file %s: %w", path, err)
+	}
+	return file, false, nil
+}
+
+// currentUser returns the name of the user running the process
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+func newLockInfo() LockInfo {
+	info := LockInfo{
+		Pid:      os.Getpid(),
+		User:     currentUser(),
+		Acquired: time.Now().UTC(),
+	}
+	info.Host, _ = os.Hostname()
+	return info
+}
+
+// newLockedError reports the holder of the lock, as far as it is known from the lock file
+func newLockedError(path string) LockedError {
+	e := LockedError{Path: path}
+	if data, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(data, &e.Holder)
+	}
+	return e
+}
@@ -0,0 +1,32 @@
+//go:build !unix
+
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+// tryLock takes the lock by creating the lock file, as flock is not available on this platform
+func tryLock(path string) (*fileLock, error) {
+	file, created, err := createLockFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		_ = file.Close()
+		return nil, newLockedError(path)
+	}
+	return &fileLock{path: path, file: file}, nil
+}
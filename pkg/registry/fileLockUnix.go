@@ -0,0 +1,62 @@
+//go:build unix
+
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// tryLock takes the lock with flock, falling back to the lock file itself on file systems without flock support
+func tryLock(path string) (*fileLock, error) {
+	for {
+		file, created, err := createLockFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		err = unix.Flock(int(file.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+		switch {
+		case err == nil:
+		case errors.Is(err, unix.EWOULDBLOCK):
+			_ = file.Close()
+			return nil, newLockedError(path)
+		case errors.Is(err, unix.ENOLCK), errors.Is(err, unix.ENOTSUP), errors.Is(err, unix.EOPNOTSUPP):
+			// Some network file systems do not support flock, whoever created the lock file holds the lock
+			if created {
+				return &fileLock{path: path, file: file}, nil
+			}
+			_ = file.Close()
+			return nil, newLockedError(path)
+		default:
+			_ = file.Close()
+			return nil, err
+		}
+
+		// The previous holder removes the lock file before releasing it, so the lock is only valid if the file is still in place
+		locked, statErr := file.Stat()
+		current, err := os.Stat(path)
+		if statErr == nil && err == nil && os.SameFile(locked, current) {
+			return &fileLock{path: path, file: file, flock: true}, nil
+		}
+		_ = file.Close()
+	}
+}
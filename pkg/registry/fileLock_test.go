@@ -0,0 +1,116 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockTimeout(t *testing.T) {
+	l, k := newTestLoader(t)
+	l.LockTimeout = 300 * time.Millisecond
+
+	lock, err := lockFile(l.Path, time.Second)
+	if err != nil {
+		t.Fatalf("could not lock registry file: %v", err)
+	}
+	defer func() { _ = lock.Unlock() }()
+
+	start := time.Now()
+	err = l.SaveWithKeyring(k, newTestRegistry("a"))
+	if elapsed := time.Since(start); elapsed < l.LockTimeout {
+		t.Errorf("SaveWithKeyring gave up after %s, want at least %s", elapsed, l.LockTimeout)
+	}
+
+	var locked LockedError
+	if !errors.Is(err, ErrLocked) || !errors.As(err, &locked) {
+		t.Fatalf("SaveWithKeyring returned %v, want %v", err, ErrLocked)
+	}
+	if locked.Holder.Pid != os.Getpid() || locked.Holder.Acquired.IsZero() {
+		t.Errorf("SaveWithKeyring reported lock holder %+v, want pid %d", locked.Holder, os.Getpid())
+	}
+	if _, err = os.Stat(l.Path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("SaveWithKeyring wrote the registry file without holding the lock")
+	}
+}
+
+func TestLockWaitsForRelease(t *testing.T) {
+	l, k := newTestLoader(t)
+	l.LockTimeout = 5 * time.Second
+
+	lock, err := lockFile(l.Path, time.Second)
+	if err != nil {
+		t.Fatalf("could not lock registry file: %v", err)
+	}
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		_ = lock.Unlock()
+	}()
+
+	if err = l.SaveWithKeyring(k, newTestRegistry("a")); err != nil {
+		t.Fatalf("SaveWithKeyring returned error: %v", err)
+	}
+	if _, err = os.Stat(l.Path + lockFileSuffix); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("lock file was not removed after saving")
+	}
+}
+
+func TestLockContention(t *testing.T) {
+	l, k := newTestLoader(t)
+	l.LockTimeout = 30 * time.Second
+	if err := l.SaveWithKeyring(k, newTestRegistry()); err != nil {
+		t.Fatalf("SaveWithKeyring returned error: %v", err)
+	}
+
+	// Every writer adds an organization in a load-modify-save cycle, none of them may be lost
+	names := []string{"a", "b", "c", "d"}
+	errs := make(chan error, len(names))
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- l.UpdateWithKeyring(k, func(r *Registry) error {
+				r.Organizations = append(r.Organizations, NewOrganization(name))
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("UpdateWithKeyring returned error: %v", err)
+		}
+	}
+	r, err := l.Load("test key")
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	got := r.GetOrganizationNames()
+	slices.Sort(got)
+	if !slices.Equal(got, names) {
+		t.Errorf("registry file holds organizations %v, want %v", got, names)
+	}
+}
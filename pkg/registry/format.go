@@ -0,0 +1,74 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Format string
+
+const (
+	FormatYaml Format = "yaml"
+	FormatJson Format = "json"
+)
+
+// DetectFormat returns the format for a registry file, based on the file extension.
+// If the extension is unknown, the format is sniffed from the file contents.
+func DetectFormat(path string, data []byte) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYaml
+	case ".json":
+		return FormatJson
+	}
+
+	// A JSON document always starts with an object or an array
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return FormatJson
+	}
+	return FormatYaml
+}
+
+func marshal(v any, f Format) ([]byte, error) {
+	switch f {
+	case FormatJson:
+		return json.MarshalIndent(v, "", "  ")
+	case FormatYaml:
+		return yaml.Marshal(v)
+	default:
+		return nil, fmt.Errorf("invalid registry format %s", f)
+	}
+}
+
+func unmarshal(data []byte, v any, f Format) error {
+	switch f {
+	case FormatJson:
+		return json.Unmarshal(data, v)
+	case FormatYaml:
+		return yaml.Unmarshal(data, v)
+	default:
+		return fmt.Errorf("invalid registry format %s", f)
+	}
+}
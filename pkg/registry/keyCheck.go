@@ -0,0 +1,91 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+)
+
+const (
+	keyCheckContext = "go-registry key check"
+)
+
+// newKeyCheck returns a verifier for a derived registry key, which does not reveal anything about the key itself
+func newKeyCheck(derivedKey string) string {
+	mac := hmac.New(sha256.New, []byte(derivedKey))
+	mac.Write([]byte(keyCheckContext))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Fingerprint returns the key check value for a passphrase, using the key derivation parameters of the registry
+func (s SecureRegistry) Fingerprint(passphrase string) (string, error) {
+	derivedKey, err := s.DeriveKey(passphrase)
+	if err != nil {
+		return "", err
+	}
+	return newKeyCheck(derivedKey), nil
+}
+
+// IdentifyKey returns the name of the candidate passphrase the registry is encrypted with
+func (s SecureRegistry) IdentifyKey(candidates map[string]string) (string, error) {
+	// Iterate in a stable order, so the result does not depend on map ordering when candidates share a passphrase
+	names := make([]string, 0, len(candidates))
+	for name := range candidates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if s.VerifyKey(candidates[name]) == nil {
+			return name, nil
+		}
+	}
+	return "", ErrInvalidKey
+}
+
+// VerifyKey returns ErrInvalidKey if the registry key is not derived from the passphrase.
+// Registries without a key check value are verified by decrypting the organizations without their own key.
+func (s SecureRegistry) VerifyKey(passphrase string) error {
+	derivedKey, err := s.DeriveKey(passphrase)
+	if err != nil {
+		return err
+	}
+	return s.verifyDerivedKey(derivedKey)
+}
+
+func (s SecureRegistry) verifyDerivedKey(derivedKey string) error {
+	if s.KeyCheck == "" {
+		for _, o := range s.Organizations {
+			if _, hasOwnKey := s.GetOrganizationKey(o.Name); hasOwnKey {
+				continue
+			}
+			// Organizations without secrets decrypt with any key, so a single organization does not prove the key
+			if _, err := o.Decrypt(derivedKey); err != nil {
+				return ErrInvalidKey
+			}
+		}
+		return nil
+	}
+
+	if !hmac.Equal([]byte(newKeyCheck(derivedKey)), []byte(s.KeyCheck)) {
+		return ErrInvalidKey
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestLoadWrongKey(t *testing.T) {
+	l, k := newTestLoader(t)
+	o := NewOrganization("a")
+	o.Registry.Machines.NetScaler.Adc.Environments = []NetScalerAdcEnvironment{
+		{Name: "prod", Credentials: []NetScalerAdcCredential{{Name: "nsroot", Username: "nsroot", Password: "secret"}}},
+	}
+	// The first organization holds no secrets, so it decrypts with any key
+	if err := l.SaveWithKeyring(k, Registry{Organizations: []Organization{NewOrganization("0"), o}}); err != nil {
+		t.Fatalf("SaveWithKeyring returned error: %v", err)
+	}
+
+	s, err := l.LoadSecure()
+	if err != nil {
+		t.Fatalf("LoadSecure returned error: %v", err)
+	}
+	if s.KeyCheck == "" {
+		t.Fatalf("registry file was saved without a key check value")
+	}
+	legacy := s
+	legacy.KeyCheck = ""
+
+	for name, s := range map[string]SecureRegistry{"key check": s, "without key check": legacy} {
+		if _, _, err = s.DecryptWithKeyring(NewKeyring("wrong key")); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("%s: DecryptWithKeyring with a wrong key returned %v, want %v", name, err, ErrInvalidKey)
+		}
+		if err = s.VerifyKey("wrong key"); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("%s: VerifyKey with a wrong key returned %v, want %v", name, err, ErrInvalidKey)
+		}
+
+		r, sealed, err := s.DecryptWithKeyring(k)
+		if err != nil {
+			t.Fatalf("%s: DecryptWithKeyring returned error: %v", name, err)
+		}
+		if !slices.Equal(r.GetOrganizationNames(), []string{"0", "a"}) || len(sealed) != 0 {
+			t.Errorf("%s: DecryptWithKeyring returned organizations %v and sealed %v, want [0 a] and []", name, r.GetOrganizationNames(), sealed)
+		}
+	}
+}
+
+func TestIdentifyKey(t *testing.T) {
+	l, k := newTestLoader(t)
+	if err := l.SaveWithKeyring(k, newTestRegistry("a")); err != nil {
+		t.Fatalf("SaveWithKeyring returned error: %v", err)
+	}
+	s, err := l.LoadSecure()
+	if err != nil {
+		t.Fatalf("LoadSecure returned error: %v", err)
+	}
+
+	name, err := s.IdentifyKey(map[string]string{"old": "old key", "current": "test key"})
+	if err != nil || name != "current" {
+		t.Errorf("IdentifyKey returned %q (%v), want current", name, err)
+	}
+	if _, err = s.IdentifyKey(map[string]string{"old": "old key"}); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("IdentifyKey without the current key returned %v, want %v", err, ErrInvalidKey)
+	}
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	KeyDerivationArgon2id = "argon2id"
+
+	DefaultArgon2idTime    uint32 = 3
+	DefaultArgon2idMemory  uint32 = 64 * 1024 // KiB
+	DefaultArgon2idThreads uint8  = 4
+
+	keyDerivationSaltLength = 16
+	keyDerivationKeyLength  = 32
+)
+
+func NewKeyDerivation() (KeyDerivation, error) {
+	var salt [keyDerivationSaltLength]byte
+	if _, err := io.ReadFull(rand.Reader, salt[:]); err != nil {
+		return KeyDerivation{}, fmt.Errorf("failed to read random data for salt: %w", err)
+	}
+
+	return KeyDerivation{
+		Algorithm: KeyDerivationArgon2id,
+		Version:   argon2.Version,
+		Salt:      hex.EncodeToString(salt[:]),
+		Time:      DefaultArgon2idTime,
+		Memory:    DefaultArgon2idMemory,
+		Threads:   DefaultArgon2idThreads,
+	}, nil
+}
+
+// KeyDerivation holds the parameters to derive the registry key from a passphrase.
+// Registries written before key derivation was introduced have an empty Algorithm and use the passphrase as-is.
+type KeyDerivation struct {
+	Algorithm string `json:"algorithm,omitempty" yaml:"algorithm,omitempty" mapstructure:"algorithm,omitempty"`
+	Version   int    `json:"version,omitempty" yaml:"version,omitempty" mapstructure:"version,omitempty"`
+	Salt      string `json:"salt,omitempty" yaml:"salt,omitempty" mapstructure:"salt,omitempty"`
+	Time      uint32 `json:"time,omitempty" yaml:"time,omitempty" mapstructure:"time,omitempty"`
+	Memory    uint32 `json:"memory,omitempty" yaml:"memory,omitempty" mapstructure:"memory,omitempty"`
+	Threads   uint8  `json:"threads,omitempty" yaml:"threads,omitempty" mapstructure:"threads,omitempty"`
+}
+
+// DeriveKey returns the key to pass to the Encrypt and Decrypt methods of the types in the registry
+func (k KeyDerivation) DeriveKey(passphrase string) (string, error) {
+	switch k.Algorithm {
+	case "":
+		return passphrase, nil
+	case KeyDerivationArgon2id:
+		if k.Version != argon2.Version {
+			return "", fmt.Errorf("unsupported %s version %d", k.Algorithm, k.Version)
+		}
+		if k.Time == 0 || k.Memory == 0 || k.Threads == 0 {
+			return "", fmt.Errorf("invalid %s parameters", k.Algorithm)
+		}
+
+		salt, err := hex.DecodeString(k.Salt)
+		if err != nil || len(salt) == 0 {
+			return "", fmt.Errorf("invalid %s salt", k.Algorithm)
+		}
+		return string(argon2.IDKey([]byte(passphrase), salt, k.Time, k.Memory, k.Threads, keyDerivationKeyLength)), nil
+	default:
+		return "", fmt.Errorf("unsupported key derivation algorithm %s", k.Algorithm)
+	}
+}
+
+func (k KeyDerivation) IsLegacy() bool {
+	return k.Algorithm == ""
+}
@@ -0,0 +1,218 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// KeyProvider returns the passphrase for a registry
+type KeyProvider interface {
+	GetKey() (string, error)
+}
+
+func NewKeyProviderChain(providers ...KeyProvider) KeyProviderChain {
+	return KeyProviderChain{
+		Providers: providers,
+	}
+}
+
+// KeyProviderChain returns the key of the first provider which succeeds.
+// Providers which have no key to offer, reported with an error matching ErrKeyNotAvailable, are skipped.
+// Any other error stops the chain, so a key source which is configured but broken is never silently bypassed.
+type KeyProviderChain struct {
+	Providers []KeyProvider
+}
+
+func (c KeyProviderChain) GetKey() (string, error) {
+	var errs []error
+	for _, p := range c.Providers {
+		key, err := p.GetKey()
+		if err == nil {
+			return key, nil
+		}
+		errs = append(errs, err)
+		if !errors.Is(err, ErrKeyNotAvailable) {
+			return "", errors.Join(errs...)
+		}
+	}
+
+	if len(errs) == 0 {
+		return "", fmt.Errorf("no key providers configured: %w", ErrKeyNotAvailable)
+	}
+	return "", errors.Join(errs...)
+}
+
+func NewEnvironmentKeyProvider(name string) EnvironmentKeyProvider {
+	return EnvironmentKeyProvider{
+		Name: name,
+	}
+}
+
+// EnvironmentKeyProvider reads the key from an environment variable
+type EnvironmentKeyProvider struct {
+	Name string
+}
+
+func (p EnvironmentKeyProvider) GetKey() (string, error) {
+	key, found := os.LookupEnv(p.Name)
+	if !found || key == "" {
+		return "", fmt.Errorf("environment variable %s is not set: %w", p.Name, ErrKeyNotAvailable)
+	}
+	return key, nil
+}
+
+func NewFileKeyProvider(path string) FileKeyProvider {
+	return FileKeyProvider{
+		Path: path,
+	}
+}
+
+// FileKeyProvider reads the key from a file, which must not be accessible by group or others.
+// Only a missing key file is reported as ErrKeyNotAvailable, a key file which is rejected stops a KeyProviderChain.
+type FileKeyProvider struct {
+	Path string
+}
+
+func (p FileKeyProvider) GetKey() (string, error) {
+	var (
+		err  error
+		info os.FileInfo
+		data []byte
+	)
+
+	if info, err = os.Stat(p.Path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("could not access key file %s: %w: %w", p.Path, err, ErrKeyNotAvailable)
+		}
+		return "", fmt.Errorf("could not access key file %s: %w", p.Path, err)
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("key file %s is not a regular file", p.Path)
+	}
+	// Windows does not report unix permissions
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("key file %s has permissions %s, it must not be accessible by group or others", p.Path, info.Mode().Perm())
+	}
+
+	if data, err = os.ReadFile(p.Path); err != nil {
+		return "", fmt.Errorf("could not read key file %s: %w", p.Path, err)
+	}
+
+	key := strings.TrimRight(string(data), "\r\n")
+	if key == "" {
+		return "", fmt.Errorf("key file %s is empty", p.Path)
+	}
+	return key, nil
+}
+
+func NewCommandKeyProvider(name string, args ...string) CommandKeyProvider {
+	return CommandKeyProvider{
+		Name: name,
+		Args: args,
+	}
+}
+
+// CommandKeyProvider reads the key from the output of a command, such as the CLI of a password manager
+type CommandKeyProvider struct {
+	Name string
+	Args []string
+}
+
+func (p CommandKeyProvider) GetKey() (string, error) {
+	var (
+		err    error
+		output []byte
+		stderr bytes.Buffer
+	)
+
+	cmd := exec.Command(p.Name, p.Args...)
+	cmd.Stderr = &stderr
+	if output, err = cmd.Output(); err != nil {
+		return "", fmt.Errorf("could not get key from command %s: %w: %s", p.Name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	key := strings.TrimRight(string(output), "\r\n")
+	if key == "" {
+		return "", fmt.Errorf("command %s did not return a key: %w", p.Name, ErrKeyNotAvailable)
+	}
+	return key, nil
+}
+
+func NewPromptKeyProvider(prompt string) PromptKeyProvider {
+	return PromptKeyProvider{
+		Prompt: prompt,
+	}
+}
+
+// PromptKeyProvider asks for the key on the terminal, without echoing the input
+type PromptKeyProvider struct {
+	Prompt string
+}
+
+func (p PromptKeyProvider) GetKey() (string, error) {
+	var (
+		err    error
+		input  *os.File
+		output *os.File
+		key    []byte
+	)
+
+	if input, output, err = openTerminal(); err != nil {
+		return "", fmt.Errorf("could not open terminal: %w: %w", err, ErrKeyNotAvailable)
+	}
+	if input != os.Stdin {
+		defer input.Close()
+	}
+
+	if !term.IsTerminal(int(input.Fd())) {
+		return "", fmt.Errorf("no terminal available: %w", ErrKeyNotAvailable)
+	}
+
+	if _, err = fmt.Fprint(output, p.Prompt); err != nil {
+		return "", err
+	}
+	key, err = term.ReadPassword(int(input.Fd()))
+	_, _ = fmt.Fprintln(output)
+	if err != nil {
+		return "", fmt.Errorf("could not read key from terminal: %w", err)
+	}
+
+	if len(key) == 0 {
+		return "", fmt.Errorf("no key entered: %w", ErrKeyNotAvailable)
+	}
+	return string(key), nil
+}
+
+// openTerminal returns the controlling terminal, so the prompt also works when stdin or stdout are redirected
+func openTerminal() (*os.File, *os.File, error) {
+	if runtime.GOOS == "windows" {
+		return os.Stdin, os.Stderr, nil
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	return tty, tty, err
+}
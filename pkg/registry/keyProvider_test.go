@@ -0,0 +1,95 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestKeyProviderChain(t *testing.T) {
+	dir := t.TempDir()
+	writeKeyFile := func(name string, content string, perm os.FileMode) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), perm); err != nil {
+			t.Fatalf("could not write key file: %v", err)
+		}
+		if err := os.Chmod(path, perm); err != nil {
+			t.Fatalf("could not change permissions of key file: %v", err)
+		}
+		return path
+	}
+	t.Setenv("REGISTRY_TEST_KEY", "")
+
+	tests := map[string]struct {
+		provider KeyProvider
+		key      string // Expected key, empty if the chain must stop with an error
+	}{
+		"key file":         {provider: NewFileKeyProvider(writeKeyFile("key", "file key\n", 0600)), key: "file key"},
+		"missing key file": {provider: NewFileKeyProvider(filepath.Join(dir, "missing")), key: "fallback key"},
+		"unset variable":   {provider: NewEnvironmentKeyProvider("REGISTRY_TEST_KEY"), key: "fallback key"},
+		"empty key file":   {provider: NewFileKeyProvider(writeKeyFile("empty", "\n", 0600))},
+		"key directory":    {provider: NewFileKeyProvider(dir)},
+	}
+	if runtime.GOOS != "windows" {
+		tests["loose permissions"] = struct {
+			provider KeyProvider
+			key      string
+		}{provider: NewFileKeyProvider(writeKeyFile("loose", "loose key", 0644))}
+	}
+
+	for name, tt := range tests {
+		fallback := &testKeyProvider{key: "fallback key"}
+		key, err := NewKeyProviderChain(tt.provider, fallback).GetKey()
+		if tt.key == "" {
+			if err == nil || errors.Is(err, ErrKeyNotAvailable) {
+				t.Errorf("%s: GetKey returned %q (%v), want an error which stops the chain", name, key, err)
+			}
+			if fallback.called {
+				t.Errorf("%s: GetKey fell through to the next provider", name)
+			}
+			continue
+		}
+		if err != nil || key != tt.key {
+			t.Errorf("%s: GetKey returned %q (%v), want %q", name, key, err, tt.key)
+		}
+	}
+}
+
+func TestKeyProviderChainNotAvailable(t *testing.T) {
+	if _, err := NewKeyProviderChain().GetKey(); !errors.Is(err, ErrKeyNotAvailable) {
+		t.Errorf("GetKey without providers returned %v, want %v", err, ErrKeyNotAvailable)
+	}
+
+	missing := NewFileKeyProvider(filepath.Join(t.TempDir(), "missing"))
+	if _, err := NewKeyProviderChain(missing, missing).GetKey(); !errors.Is(err, ErrKeyNotAvailable) {
+		t.Errorf("GetKey without any key returned %v, want %v", err, ErrKeyNotAvailable)
+	}
+}
+
+type testKeyProvider struct {
+	key    string
+	called bool
+}
+
+func (p *testKeyProvider) GetKey() (string, error) {
+	p.called = true
+	return p.key, nil
+}
@@ -0,0 +1,421 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"crypto/hmac"
+	"fmt"
+	"slices"
+
+	"github.com/corelayer/go-cryptostruct/pkg/cryptostruct"
+)
+
+func NewKeyring(defaultKey string) Keyring {
+	return Keyring{
+		Default:       defaultKey,
+		Organizations: make(map[string]string),
+	}
+}
+
+// Keyring holds the passphrases to encrypt and decrypt a registry.
+// Organizations without a passphrase of their own use the Default passphrase, which is the registry key.
+type Keyring struct {
+	Default       string
+	Organizations map[string]string
+}
+
+func (k Keyring) SetOrganizationKey(name string, passphrase string) Keyring {
+	organizations := make(map[string]string, len(k.Organizations)+1)
+	for n, p := range k.Organizations {
+		organizations[n] = p
+	}
+	organizations[name] = passphrase
+
+	k.Organizations = organizations
+	return k
+}
+
+// OrganizationKey holds the key derivation parameters for an organization which is encrypted with its own key
+type OrganizationKey struct {
+	Organization  string        `json:"organization" yaml:"organization" mapstructure:"organization"`
+	KeyDerivation KeyDerivation `json:"keyDerivation" yaml:"keyDerivation" mapstructure:"keyDerivation"`
+	KeyCheck      string        `json:"keyCheck" yaml:"keyCheck" mapstructure:"keyCheck"`
+}
+
+// EncryptWithKeyring encrypts the registry, using a separate key for every organization that has its own passphrase in the keyring
+func (r Registry) EncryptWithKeyring(k Keyring) (SecureRegistry, error) {
+	return SecureRegistry{}.reseal(r, k, DefaultCipherSuite, false)
+}
+
+// DecryptOrganization decrypts a single organization, using its own key if it has one, or the registry key otherwise
+func (s SecureRegistry) DecryptOrganization(name string, passphrase string) (Organization, error) {
+	var (
+		err        error
+		o          SecureOrganization
+		derivedKey string
+	)
+
+	if o, err = s.GetOrganizationByName(name); err != nil {
+		return Organization{}, err
+	}
+	if derivedKey, err = s.DeriveOrganizationKey(name, passphrase); err != nil {
+		return Organization{}, err
+	}
+	return o.Decrypt(derivedKey)
+}
+
+// DecryptWithKeyring decrypts all organizations for which the keyring holds a key.
+// The names of the organizations which could not be decrypted are returned, those organizations remain sealed.
+func (s SecureRegistry) DecryptWithKeyring(k Keyring) (Registry, []string, error) {
+	var (
+		err          error
+		registryKey  string
+		derivedKey   string
+		unlocked     bool
+		organization Organization
+	)
+
+	if registryKey, err = s.unlockRegistry(k); err != nil {
+		return Registry{}, nil, err
+	}
+
+	r := Registry{
+		Organizations: make([]Organization, 0, len(s.Organizations)),
+	}
+	sealed := make([]string, 0)
+
+	for _, o := range s.Organizations {
+		if derivedKey, unlocked, err = s.unlockOrganization(o.Name, k, registryKey); err != nil {
+			return Registry{}, nil, err
+		}
+		if !unlocked {
+			sealed = append(sealed, o.Name)
+			continue
+		}
+
+		if organization, err = o.Decrypt(derivedKey); err != nil {
+			return Registry{}, nil, fmt.Errorf("could not decrypt organization %s: %w", o.Name, err)
+		}
+		r.Organizations = append(r.Organizations, organization)
+	}
+	return r, sealed, nil
+}
+
+// DeriveOrganizationKey returns the key to decrypt individual items of an organization
+func (s SecureRegistry) DeriveOrganizationKey(name string, passphrase string) (string, error) {
+	if _, hasOwnKey := s.GetOrganizationKey(name); !hasOwnKey {
+		return s.unlockRegistry(NewKeyring(passphrase))
+	}
+
+	derivedKey, _, err := s.unlockOrganization(name, NewKeyring("").SetOrganizationKey(name, passphrase), "")
+	return derivedKey, err
+}
+
+func (s SecureRegistry) GetOrganizationKey(name string) (OrganizationKey, bool) {
+	for _, k := range s.OrganizationKeys {
+		if k.Organization == name {
+			return k, true
+		}
+	}
+	return OrganizationKey{}, false
+}
+
+// Reseal encrypts the registry with the keyring, while keeping the organizations which are sealed for the keyring unchanged.
+// An organization in r which is sealed in s for the keyring is not replaced, an error matching ErrAlreadyExists and ErrInvalidKey is returned instead.
+func (s SecureRegistry) Reseal(r Registry, k Keyring) (SecureRegistry, error) {
+	cipherSuite := s.CryptoParams.CipherSuite
+	if cipherSuite == "" {
+		cipherSuite = DefaultCipherSuite
+	}
+	if err := s.checkSealed(r, k); err != nil {
+		return SecureRegistry{}, err
+	}
+	return s.reseal(r, k, cipherSuite, false)
+}
+
+// checkSealed returns an error if r holds an organization which is sealed in s for the keyring,
+// as saving r would replace the sealed organization and lose its secrets
+func (s SecureRegistry) checkSealed(r Registry, k Keyring) error {
+	var (
+		err         error
+		registryKey string
+		unlocked    bool
+		checked     bool
+	)
+
+	for _, o := range r.Organizations {
+		if _, err = s.GetOrganizationByName(o.Name); err != nil {
+			continue
+		}
+		if _, hasOwnKey := s.GetOrganizationKey(o.Name); hasOwnKey {
+			if _, unlocked, err = s.unlockOrganization(o.Name, k, ""); err != nil {
+				return err
+			}
+			if !unlocked {
+				return newSealedOrganizationError(o.Name)
+			}
+			continue
+		}
+
+		if !checked {
+			// A wrong key is not an error here, every organization without its own key is sealed instead
+			registryKey, _ = s.unlockRegistry(k)
+			checked = true
+		}
+		if registryKey == "" {
+			return newSealedOrganizationError(o.Name)
+		}
+	}
+	return nil
+}
+
+// reseal encrypts the registry with the keyring.
+// When keepKeys is set, the key derivation parameters of the registry and of organizations with their own key are kept
+// as long as the keyring still unlocks them, otherwise new parameters are derived on every reseal.
+func (s SecureRegistry) reseal(r Registry, k Keyring, cipherSuite string, keepKeys bool) (SecureRegistry, error) {
+	var (
+		err         error
+		registryKey string
+		output      SecureRegistry
+	)
+
+	output = SecureRegistry{
+		Organizations:    make([]SecureOrganization, 0, len(r.Organizations)),
+		OrganizationKeys: make([]OrganizationKey, 0),
+		Revision:         s.Revision,
+		KeyDerivation:    s.KeyDerivation,
+		KeyCheck:         s.KeyCheck,
+		Envelope:         s.Envelope,
+	}
+	if output.CryptoParams, err = cryptostruct.NewCryptoParams(cipherSuite); err != nil {
+		return SecureRegistry{}, err
+	}
+
+	// Derive a new registry key when the keyring holds the default passphrase
+	if k.Default != "" {
+		// The envelope only remains valid as long as the data key is used as the registry passphrase
+		if s.HasEnvelope() {
+			if _, err = s.unlockRegistry(k); err != nil {
+				return SecureRegistry{}, fmt.Errorf("registry is encrypted for recipients and the key is not its data key: %w", err)
+			}
+		}
+
+		if keepKeys && s.KeyCheck != "" {
+			// A wrong key is not an error here, the registry key is replaced instead
+			registryKey, _ = s.unlockRegistry(k)
+		}
+		if registryKey == "" {
+			if output.KeyDerivation, err = NewKeyDerivation(); err != nil {
+				return SecureRegistry{}, err
+			}
+			if registryKey, err = output.KeyDerivation.DeriveKey(k.Default); err != nil {
+				return SecureRegistry{}, err
+			}
+			output.KeyCheck = newKeyCheck(registryKey)
+		}
+	}
+
+	for _, o := range r.Organizations {
+		var (
+			encrypted SecureOrganization
+			ok        OrganizationKey
+		)
+
+		passphrase, explicit := k.Organizations[o.Name]
+		_, hasOwnKey := s.GetOrganizationKey(o.Name)
+
+		switch {
+		case explicit || hasOwnKey:
+			if !explicit {
+				passphrase = k.Default
+			}
+			if passphrase == "" {
+				return SecureRegistry{}, fmt.Errorf("no key for organization %s", o.Name)
+			}
+			if keepKeys && hasOwnKey {
+				// Never fall back to a new key, an organization the passphrase does not unlock would be overwritten
+				if encrypted, ok, err = s.reencryptOrganizationWithOwnKey(o, passphrase, cipherSuite); err != nil {
+					return SecureRegistry{}, err
+				}
+				output.OrganizationKeys = append(output.OrganizationKeys, ok)
+				break
+			}
+			if encrypted, ok, err = encryptOrganizationWithOwnKey(o, passphrase, cipherSuite); err != nil {
+				return SecureRegistry{}, err
+			}
+			output.OrganizationKeys = append(output.OrganizationKeys, ok)
+		case registryKey != "":
+			if encrypted, err = encrypt[SecureOrganization](registryKey, cipherSuite, o); err != nil {
+				return SecureRegistry{}, fmt.Errorf("could not encrypt organization %s: %w", o.Name, err)
+			}
+		default:
+			return SecureRegistry{}, fmt.Errorf("no key for organization %s", o.Name)
+		}
+		output.Organizations = append(output.Organizations, encrypted)
+	}
+
+	// Keep the organizations which could not be decrypted with the keyring, organizations which could be decrypted were removed on purpose
+	for _, o := range s.Organizations {
+		if _, err = r.GetOrganizationByName(o.Name); err == nil {
+			continue
+		}
+
+		ok, hasOwnKey := s.GetOrganizationKey(o.Name)
+		if !hasOwnKey {
+			if k.Default == "" {
+				output.Organizations = append(output.Organizations, o)
+				continue
+			}
+			// The registry key is replaced, so an organization sealed with the previous registry key cannot be kept
+			if _, err = s.unlockRegistry(k); err != nil {
+				return SecureRegistry{}, fmt.Errorf("organization %s is sealed with the previous registry key: %w", o.Name, err)
+			}
+			continue
+		}
+
+		var unlocked bool
+		if _, unlocked, err = s.unlockOrganization(o.Name, k, ""); err != nil {
+			return SecureRegistry{}, err
+		}
+		if !unlocked {
+			output.OrganizationKeys = append(output.OrganizationKeys, ok)
+			output.Organizations = append(output.Organizations, o)
+		}
+	}
+
+	return output, nil
+}
+
+// unlockOrganization returns the derived key for an organization if the keyring holds a key for it.
+// Organizations without their own key are unlocked with registryKey, as returned by unlockRegistry.
+// An explicit organization key which does not match results in ErrInvalidKey.
+func (s SecureRegistry) unlockOrganization(name string, k Keyring, registryKey string) (string, bool, error) {
+	var (
+		err        error
+		derivedKey string
+	)
+
+	ok, hasOwnKey := s.GetOrganizationKey(name)
+	if !hasOwnKey {
+		return registryKey, registryKey != "", nil
+	}
+
+	passphrase, explicit := k.Organizations[name]
+	if !explicit {
+		passphrase = k.Default
+	}
+	if passphrase == "" {
+		return "", false, nil
+	}
+
+	if derivedKey, err = ok.KeyDerivation.DeriveKey(passphrase); err != nil {
+		return "", false, err
+	}
+	if !hmac.Equal([]byte(newKeyCheck(derivedKey)), []byte(ok.KeyCheck)) {
+		if explicit {
+			return "", false, fmt.Errorf("could not decrypt organization %s: %w", name, ErrInvalidKey)
+		}
+		// The registry key does not unlock an organization with its own key
+		return "", false, nil
+	}
+	return derivedKey, true, nil
+}
+
+// unlockRegistry returns the derived registry key for the default passphrase of the keyring, or an empty string if there is none
+func (s SecureRegistry) unlockRegistry(k Keyring) (string, error) {
+	var (
+		err        error
+		derivedKey string
+	)
+
+	if k.Default == "" {
+		return "", nil
+	}
+	if derivedKey, err = s.DeriveKey(k.Default); err != nil {
+		return "", err
+	}
+
+	// Fail early on a wrong key, instead of with a cipher error somewhere in the registry.
+	// Registry files written before the key check value was introduced are verified by decrypting their organizations.
+	if err = s.verifyDerivedKey(derivedKey); err != nil {
+		return "", err
+	}
+	return derivedKey, nil
+}
+
+func encryptOrganizationWithOwnKey(o Organization, passphrase string, cipherSuite string) (SecureOrganization, OrganizationKey, error) {
+	var (
+		err        error
+		kd         KeyDerivation
+		derivedKey string
+		encrypted  SecureOrganization
+	)
+
+	if kd, err = NewKeyDerivation(); err != nil {
+		return SecureOrganization{}, OrganizationKey{}, err
+	}
+	if derivedKey, err = kd.DeriveKey(passphrase); err != nil {
+		return SecureOrganization{}, OrganizationKey{}, err
+	}
+	if encrypted, err = encrypt[SecureOrganization](derivedKey, cipherSuite, o); err != nil {
+		return SecureOrganization{}, OrganizationKey{}, fmt.Errorf("could not encrypt organization %s: %w", o.Name, err)
+	}
+
+	return encrypted, OrganizationKey{
+		Organization:  o.Name,
+		KeyDerivation: kd,
+		KeyCheck:      newKeyCheck(derivedKey),
+	}, nil
+}
+
+// reencryptOrganizationWithOwnKey encrypts an organization with its existing own key, if the passphrase unlocks it
+func (s SecureRegistry) reencryptOrganizationWithOwnKey(o Organization, passphrase string, cipherSuite string) (SecureOrganization, OrganizationKey, error) {
+	var (
+		err        error
+		derivedKey string
+		unlocked   bool
+		encrypted  SecureOrganization
+	)
+
+	ok, _ := s.GetOrganizationKey(o.Name)
+	if derivedKey, unlocked, err = s.unlockOrganization(o.Name, NewKeyring("").SetOrganizationKey(o.Name, passphrase), ""); err != nil {
+		return SecureOrganization{}, OrganizationKey{}, err
+	}
+	if !unlocked {
+		return SecureOrganization{}, OrganizationKey{}, fmt.Errorf("could not unlock organization %s: %w", o.Name, ErrInvalidKey)
+	}
+	if encrypted, err = encrypt[SecureOrganization](derivedKey, cipherSuite, o); err != nil {
+		return SecureOrganization{}, OrganizationKey{}, fmt.Errorf("could not encrypt organization %s: %w", o.Name, err)
+	}
+	return encrypted, ok, nil
+}
+
+// checkSealedNames returns an error if r holds one of the sealed organizations, as returned by DecryptWithKeyring
+func checkSealedNames(r Registry, sealed []string) error {
+	for _, o := range r.Organizations {
+		if slices.Contains(sealed, o.Name) {
+			return newSealedOrganizationError(o.Name)
+		}
+	}
+	return nil
+}
+
+// newSealedOrganizationError is returned when a registry holds an organization which is sealed for the keyring,
+// saving the registry would overwrite the sealed organization and its secrets
+func newSealedOrganizationError(name string) error {
+	return fmt.Errorf("%w and cannot be unlocked with the keyring: %w", NewItemAlreadyExistsError("organization", name), ErrInvalidKey)
+}
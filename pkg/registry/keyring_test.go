@@ -0,0 +1,145 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestSaveKeepsSealedOrganizations(t *testing.T) {
+	for _, canonical := range []bool{true, false} {
+		l, full := newTestSealedRegistry(t)
+		l.Canonical = canonical
+		partial := NewKeyring("test key")
+
+		before, err := l.LoadSecure()
+		if err != nil {
+			t.Fatalf("LoadSecure returned error: %v", err)
+		}
+
+		r, sealed, err := l.LoadWithKeyring(partial)
+		if err != nil {
+			t.Fatalf("LoadWithKeyring returned error: %v", err)
+		}
+		if !slices.Equal(r.GetOrganizationNames(), []string{"a"}) || !slices.Equal(sealed, []string{"b"}) {
+			t.Fatalf("LoadWithKeyring returned organizations %v and sealed %v, want [a] and [b]", r.GetOrganizationNames(), sealed)
+		}
+
+		r.Organizations[0].Registry.Machines.NetScaler.Adc.Environments[0].Credentials[0].Password = "changed"
+		if err = l.SaveWithKeyring(partial, r); err != nil {
+			t.Fatalf("canonical %t: SaveWithKeyring returned error: %v", canonical, err)
+		}
+
+		after, err := l.LoadSecure()
+		if err != nil {
+			t.Fatalf("LoadSecure returned error: %v", err)
+		}
+		b, _ := before.GetOrganizationByName("b")
+		if got, err := after.GetOrganizationByName("b"); err != nil || !reflect.DeepEqual(got, b) {
+			t.Errorf("canonical %t: sealed organization b was not kept as it was (%v)", canonical, err)
+		}
+		bKey, _ := before.GetOrganizationKey("b")
+		if got, _ := after.GetOrganizationKey("b"); !reflect.DeepEqual(got, bKey) {
+			t.Errorf("canonical %t: key of sealed organization b was not kept", canonical)
+		}
+
+		decrypted, sealed, err := l.LoadWithKeyring(full)
+		if err != nil || len(sealed) != 0 {
+			t.Fatalf("canonical %t: LoadWithKeyring with the full keyring returned sealed %v (%v)", canonical, sealed, err)
+		}
+		passwords := make([]string, 0, len(decrypted.Organizations))
+		for _, o := range decrypted.Organizations {
+			passwords = append(passwords, o.Registry.Machines.NetScaler.Adc.Environments[0].Credentials[0].Password)
+		}
+		if !slices.Equal(passwords, []string{"changed", "b secret"}) {
+			t.Errorf("canonical %t: registry holds passwords %v, want [changed b secret]", canonical, passwords)
+		}
+	}
+}
+
+func TestSaveRejectsSealedOrganizations(t *testing.T) {
+	l, _ := newTestSealedRegistry(t)
+	partial := NewKeyring("test key")
+	data, err := os.ReadFile(l.Path)
+	if err != nil {
+		t.Fatalf("could not read registry file: %v", err)
+	}
+
+	addB := func(r *Registry) error {
+		r.Organizations = append(r.Organizations, newTestOrganization("b", "overwritten"))
+		return nil
+	}
+	r, _, err := l.LoadWithKeyring(partial)
+	if err != nil {
+		t.Fatalf("LoadWithKeyring returned error: %v", err)
+	}
+	_ = addB(&r)
+	s, err := l.LoadSecure()
+	if err != nil {
+		t.Fatalf("LoadSecure returned error: %v", err)
+	}
+	store, err := NewStore(l, partial)
+	if err != nil {
+		t.Fatalf("NewStore returned error: %v", err)
+	}
+
+	tests := map[string]func() error{
+		"SaveWithKeyring": func() error { return l.SaveWithKeyring(partial, r) },
+		"UpdateWithKeyring": func() error {
+			return l.UpdateWithKeyring(partial, addB)
+		},
+		"Reseal": func() error {
+			_, err := s.Reseal(r, partial)
+			return err
+		},
+		"ResealCanonical": func() error {
+			_, err := s.ResealCanonical(r, partial)
+			return err
+		},
+		"Store.Update": func() error { return store.Update(addB) },
+	}
+	for name, fn := range tests {
+		if err = fn(); !errors.Is(err, ErrAlreadyExists) || !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("%s overwriting a sealed organization returned %v, want %v and %v", name, err, ErrAlreadyExists, ErrInvalidKey)
+		}
+	}
+
+	written, err := os.ReadFile(l.Path)
+	if err != nil {
+		t.Fatalf("could not read registry file: %v", err)
+	}
+	if !bytes.Equal(written, data) {
+		t.Errorf("registry file was changed while overwriting a sealed organization")
+	}
+}
+
+// newTestSealedRegistry saves a registry file with organization a under the registry key and organization b under its own key
+func newTestSealedRegistry(t *testing.T) (Loader, Keyring) {
+	t.Helper()
+	l, k := newTestLoader(t)
+	full := k.SetOrganizationKey("b", "b key")
+	r := Registry{Organizations: []Organization{newTestOrganization("a", "a secret"), newTestOrganization("b", "b secret")}}
+	if err := l.SaveWithKeyring(full, r); err != nil {
+		t.Fatalf("SaveWithKeyring returned error: %v", err)
+	}
+	return l, full
+}
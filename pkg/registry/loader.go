@@ -0,0 +1,380 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+const (
+	DefaultFileMode = os.FileMode(0600)
+)
+
+func NewLoader(path string) Loader {
+	return Loader{
+		Path:        path,
+		CipherSuite: DefaultCipherSuite,
+		FileMode:    DefaultFileMode,
+		Canonical:   true,
+		LockTimeout: DefaultLockTimeout,
+	}
+}
+
+// Loader reads and writes a SecureRegistry file on disk.
+type Loader struct {
+	Path         string        // Location of the registry file
+	Format       Format        // File format, detected from the file extension or contents when empty
+	CipherSuite  string        // Cipher suite used to encrypt the registry when saving
+	FileMode     os.FileMode   // Permissions for newly created registry files
+	Canonical    bool          // Sort collections and keep the ciphertext of unchanged items when saving, to keep diffs of registry files small
+	LockTimeout  time.Duration // Time to wait for another process to release the lock on the registry file when saving
+	KeyProviders []KeyProvider // Providers for the registry key, the first one which succeeds is used
+	Audit        *AuditLog     // Records the changes saved to the registry file, nil to disable auditing
+}
+
+// GetKey returns the registry key from the first key provider which succeeds
+func (l Loader) GetKey() (string, error) {
+	return NewKeyProviderChain(l.KeyProviders...).GetKey()
+}
+
+func (l Loader) Load(key string) (Registry, error) {
+	var (
+		err error
+		s   SecureRegistry
+		r   Registry
+	)
+
+	if s, err = l.LoadSecure(); err != nil {
+		return Registry{}, err
+	}
+
+	if r, err = s.Decrypt(key); err != nil {
+		return Registry{}, fmt.Errorf("could not decrypt registry file %s: %w", l.Path, err)
+	}
+	return r, nil
+}
+
+// LoadWithKeyring decrypts the organizations for which the keyring holds a key.
+// The names of the organizations which remain sealed are returned.
+func (l Loader) LoadWithKeyring(k Keyring) (Registry, []string, error) {
+	var (
+		err    error
+		s      SecureRegistry
+		r      Registry
+		sealed []string
+	)
+
+	if s, err = l.LoadSecure(); err != nil {
+		return Registry{}, nil, err
+	}
+
+	if r, sealed, err = s.DecryptWithKeyring(k); err != nil {
+		return Registry{}, nil, fmt.Errorf("could not decrypt registry file %s: %w", l.Path, err)
+	}
+	return r, sealed, nil
+}
+
+// LoadWithKeyProviders decrypts the registry file with the key from the key providers of the loader
+func (l Loader) LoadWithKeyProviders() (Registry, error) {
+	key, err := l.GetKey()
+	if err != nil {
+		return Registry{}, fmt.Errorf("could not get key for registry file %s: %w", l.Path, err)
+	}
+	return l.Load(key)
+}
+
+// LoadWithIdentity decrypts a registry file which is encrypted for recipients, using an age identity
+func (l Loader) LoadWithIdentity(identity string) (Registry, error) {
+	var (
+		err     error
+		s       SecureRegistry
+		dataKey string
+		r       Registry
+	)
+
+	if s, err = l.LoadSecure(); err != nil {
+		return Registry{}, err
+	}
+	if dataKey, err = s.UnwrapDataKey(identity); err != nil {
+		return Registry{}, fmt.Errorf("could not decrypt registry file %s: %w", l.Path, err)
+	}
+	if r, err = s.Decrypt(dataKey); err != nil {
+		return Registry{}, fmt.Errorf("could not decrypt registry file %s: %w", l.Path, err)
+	}
+	return r, nil
+}
+
+func (l Loader) LoadSecure() (SecureRegistry, error) {
+	var (
+		err  error
+		data []byte
+		s    SecureRegistry
+	)
+
+	if data, err = os.ReadFile(l.Path); err != nil {
+		return SecureRegistry{}, fmt.Errorf("could not read registry file %s: %w", l.Path, err)
+	}
+
+	format := l.getFormat(data)
+	if data, err = migrateData(data, format); err != nil {
+		return SecureRegistry{}, fmt.Errorf("could not migrate registry file %s: %w", l.Path, err)
+	}
+	if err = unmarshal(data, &s, format); err != nil {
+		return SecureRegistry{}, fmt.Errorf("could not parse registry file %s: %w", l.Path, err)
+	}
+	return s, nil
+}
+
+func (l Loader) Save(key string, r Registry) error {
+	return l.SaveWithKeyring(NewKeyring(key), r)
+}
+
+// SaveWithKeyProviders encrypts the registry with the key from the key providers of the loader and saves it
+func (l Loader) SaveWithKeyProviders(r Registry) error {
+	key, err := l.GetKey()
+	if err != nil {
+		return fmt.Errorf("could not get key for registry file %s: %w", l.Path, err)
+	}
+	return l.Save(key, r)
+}
+
+// SaveWithKeyring encrypts the registry with the keyring and saves it.
+// Organizations in the existing file which are sealed for the keyring are kept.
+func (l Loader) SaveWithKeyring(k Keyring, r Registry) error {
+	return l.withLock(func() error {
+		_, err := l.saveWithKeyring(k, r, false, 0)
+		return err
+	})
+}
+
+// SaveIfRevision saves the registry like SaveWithKeyring, but only if the registry file is still at the given revision.
+// A RevisionConflictError is returned if another writer saved the file in the meantime, otherwise the new revision is returned.
+// A registry file which does not exist yet is at revision 0.
+func (l Loader) SaveIfRevision(k Keyring, r Registry, revision uint64) (uint64, error) {
+	var saved uint64
+	err := l.withLock(func() error {
+		var err error
+		saved, err = l.saveWithKeyring(k, r, true, revision)
+		return err
+	})
+	return saved, err
+}
+
+// SaveForRecipients encrypts the registry with a new data key, which is wrapped for the age recipients
+func (l Loader) SaveForRecipients(recipients []string, r Registry) error {
+	if l.Canonical {
+		r = r.Sorted()
+	}
+	s, err := SecureRegistry{}.encryptForRecipients(r, recipients, l.CipherSuite)
+	if err != nil {
+		return fmt.Errorf("could not encrypt registry for file %s: %w", l.Path, err)
+	}
+	return l.withLock(func() error {
+		return l.replace(s, r)
+	})
+}
+
+// ReplaceWithKeyring encrypts the registry with the keyring and replaces the registry file with it.
+// Unlike SaveWithKeyring nothing of the existing file is kept, not even the organizations which are sealed for the keyring.
+func (l Loader) ReplaceWithKeyring(k Keyring, r Registry) error {
+	if l.Canonical {
+		r = r.Sorted()
+	}
+	s, err := SecureRegistry{}.reseal(r, k, l.CipherSuite, false)
+	if err != nil {
+		return fmt.Errorf("could not encrypt registry for file %s: %w", l.Path, err)
+	}
+	return l.withLock(func() error {
+		return l.replace(s, r)
+	})
+}
+
+// SaveWithIdentity saves a registry file which is encrypted for recipients, reusing its data key and recipients
+func (l Loader) SaveWithIdentity(identity string, r Registry) error {
+	return l.withLock(func() error {
+		return l.saveWithIdentity(identity, r)
+	})
+}
+
+// SaveSecure writes the SecureRegistry to the registry file, without taking the lock on the registry file
+func (l Loader) SaveSecure(s SecureRegistry) error {
+	var (
+		err  error
+		data []byte
+		perm os.FileMode
+	)
+
+	if data, perm, err = l.serialize(s); err != nil {
+		return err
+	}
+	return writeFileAtomic(l.Path, data, perm)
+}
+
+func (l Loader) WithKeyProviders(providers ...KeyProvider) Loader {
+	l.KeyProviders = providers
+	return l
+}
+
+func (l Loader) getFormat(data []byte) Format {
+	if l.Format != "" {
+		return l.Format
+	}
+	return DetectFormat(l.Path, data)
+}
+
+// serialize returns the contents and permissions for the registry file, keeping the format and permissions of an existing file
+func (l Loader) serialize(s SecureRegistry) ([]byte, os.FileMode, error) {
+	var (
+		err  error
+		data []byte
+	)
+
+	perm := l.FileMode
+	existing, _ := os.ReadFile(l.Path)
+	if info, statErr := os.Stat(l.Path); statErr == nil {
+		perm = info.Mode().Perm()
+	} else if !errors.Is(statErr, fs.ErrNotExist) {
+		return nil, 0, fmt.Errorf("could not access registry file %s: %w", l.Path, statErr)
+	}
+
+	s.SchemaVersion = CurrentSchemaVersion
+	if data, err = marshal(s, l.getFormat(existing)); err != nil {
+		return nil, 0, fmt.Errorf("could not serialize registry for file %s: %w", l.Path, err)
+	}
+	return data, perm, nil
+}
+
+// replace writes s, which holds r, as the next revision of the registry file, without keeping anything of the existing file
+func (l Loader) replace(s SecureRegistry, r Registry) error {
+	var (
+		err      error
+		exists   bool
+		existing SecureRegistry
+	)
+
+	if _, err = os.Stat(l.Path); err == nil {
+		exists = true
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("could not access registry file %s: %w", l.Path, err)
+	}
+
+	// Keep counting revisions, so stores holding the previous contents reload the registry file.
+	// An existing file which cannot be parsed is replaced as well, unless it was written with a newer schema version.
+	if existing, err = l.LoadSecure(); err == nil {
+		s.Revision = existing.Revision + 1
+	} else if errors.Is(err, ErrUnsupportedSchemaVersion) {
+		return err
+	} else {
+		s.Revision = 1
+	}
+	if err = l.SaveSecure(s); err != nil {
+		return err
+	}
+	if l.Audit == nil {
+		return nil
+	}
+
+	// The previous contents are not decrypted, so only a new registry file can be compared
+	if exists {
+		err = l.Audit.RecordReplaced(r, s.Revision)
+	} else {
+		err = l.Audit.RecordChanges(Registry{}, r, s.Revision)
+	}
+	if err != nil {
+		return fmt.Errorf("saved registry file %s, but could not record the changes: %w", l.Path, err)
+	}
+	return nil
+}
+
+// saveWithKeyring encrypts and saves the registry with the next revision, checking the revision of the existing file first if requested
+func (l Loader) saveWithKeyring(k Keyring, r Registry, checkRevision bool, revision uint64) (uint64, error) {
+	existing, err := l.loadExisting()
+	if err != nil {
+		return 0, err
+	}
+	if checkRevision && existing.Revision != revision {
+		return 0, RevisionConflictError{Path: l.Path, Expected: revision, Actual: existing.Revision}
+	}
+	return l.saveRevision(k, r, existing, existing.Revision+1)
+}
+
+// loadExisting returns the registry file, or an empty SecureRegistry at revision 0 if it does not exist yet
+func (l Loader) loadExisting() (SecureRegistry, error) {
+	if _, err := os.Stat(l.Path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return SecureRegistry{}, nil
+		}
+		return SecureRegistry{}, fmt.Errorf("could not access registry file %s: %w", l.Path, err)
+	}
+	return l.LoadSecure()
+}
+
+// saveRevision encrypts the registry, reusing what it can from the existing registry file, and saves it as the given revision
+func (l Loader) saveRevision(k Keyring, r Registry, existing SecureRegistry, revision uint64) (uint64, error) {
+	var (
+		err      error
+		s        SecureRegistry
+		previous Registry
+	)
+
+	if l.Audit != nil {
+		// Organizations which are sealed for the keyring are kept as they are, so they have no changes to record
+		if previous, _, err = existing.DecryptWithKeyring(k); err != nil {
+			return 0, fmt.Errorf("could not decrypt registry file %s: %w", l.Path, err)
+		}
+	}
+
+	if l.Canonical {
+		s, err = existing.resealCanonical(r, k, l.CipherSuite)
+	} else if err = existing.checkSealed(r, k); err == nil {
+		s, err = existing.reseal(r, k, l.CipherSuite, false)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("could not encrypt registry for file %s: %w", l.Path, err)
+	}
+	s.Revision = revision
+	if err = l.SaveSecure(s); err != nil {
+		return 0, err
+	}
+	if l.Audit != nil {
+		if err = l.Audit.RecordChanges(previous, r, s.Revision); err != nil {
+			return s.Revision, fmt.Errorf("saved registry file %s, but could not record the changes: %w", l.Path, err)
+		}
+	}
+	return s.Revision, nil
+}
+
+func (l Loader) saveWithIdentity(identity string, r Registry) error {
+	var (
+		err     error
+		s       SecureRegistry
+		dataKey string
+	)
+
+	if s, err = l.LoadSecure(); err != nil {
+		return err
+	}
+	if dataKey, err = s.UnwrapDataKey(identity); err != nil {
+		return fmt.Errorf("could not save registry file %s: %w", l.Path, err)
+	}
+	_, err = l.saveWithKeyring(NewKeyring(dataKey), r, false, 0)
+	return err
+}
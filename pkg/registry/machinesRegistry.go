@@ -30,6 +30,10 @@ type MachinesRegistry struct {
 	NetScaler NetScalerRegistry `json:"netscaler,omitempty" yaml:"netscaler,omitempty" mapstructure:"netscaler,omitempty" secure:"true"`
 }
 
+func (r MachinesRegistry) Encrypt(key string) (SecureMachinesRegistry, error) {
+	return encrypt[SecureMachinesRegistry](key, DefaultCipherSuite, r)
+}
+
 func (r MachinesRegistry) GetTransformConfig() cryptostruct.TransformConfig {
 	return cryptostruct.TransformConfig{
 		Decrypted: MachinesRegistry{},
@@ -37,11 +41,23 @@ func (r MachinesRegistry) GetTransformConfig() cryptostruct.TransformConfig {
 	}
 }
 
+func (r MachinesRegistry) Validate() error {
+	return r.validate("").errorOrNil()
+}
+
+func (r MachinesRegistry) validate(path string) ValidationErrors {
+	return r.NetScaler.validate(childPath(path, "netscaler"))
+}
+
 type SecureMachinesRegistry struct {
 	NetScaler    SecureNetScalerRegistry   `json:"netscaler,omitempty" yaml:"netscaler,omitempty" mapstructure:"netscaler,omitempty" secure:"true"`
 	CryptoParams cryptostruct.CryptoParams `json:"cryptoParams" yaml:"cryptoParams" mapstructure:"cryptoParams"`
 }
 
+func (s SecureMachinesRegistry) Decrypt(key string) (MachinesRegistry, error) {
+	return decrypt[MachinesRegistry](key, s)
+}
+
 func (s SecureMachinesRegistry) GetCryptoParams() cryptostruct.CryptoParams {
 	return s.CryptoParams
 }
@@ -30,6 +30,19 @@ type MailRegistry struct {
 	SmtpServers []SmtpServer `json:"smtpServers,omitempty" yaml:"smtpServers,omitempty" mapstructure:"smtpServers,omitempty" secure:"true"`
 }
 
+func (r MailRegistry) AddSmtpServer(server SmtpServer) (MailRegistry, error) {
+	smtpServers, err := addItem(r.SmtpServers, server, "smtp server", "")
+	if err != nil {
+		return r, err
+	}
+	r.SmtpServers = smtpServers
+	return r, nil
+}
+
+func (r MailRegistry) Encrypt(key string) (SecureMailRegistry, error) {
+	return encrypt[SecureMailRegistry](key, DefaultCipherSuite, r)
+}
+
 func (r MailRegistry) GetSmtpServerByName(name string) (SmtpServer, error) {
 	for _, s := range r.SmtpServers {
 		if s.Name == name {
@@ -46,11 +59,50 @@ func (r MailRegistry) GetTransformConfig() cryptostruct.TransformConfig {
 	}
 }
 
+func (r MailRegistry) RemoveSmtpServer(name string) (MailRegistry, error) {
+	smtpServers, err := removeItem(r.SmtpServers, name, "smtp server", "")
+	if err != nil {
+		return r, err
+	}
+	r.SmtpServers = smtpServers
+	return r, nil
+}
+
+func (r MailRegistry) UpdateSmtpServer(server SmtpServer) (MailRegistry, error) {
+	smtpServers, err := updateItem(r.SmtpServers, server, "smtp server", "")
+	if err != nil {
+		return r, err
+	}
+	r.SmtpServers = smtpServers
+	return r, nil
+}
+
+func (r MailRegistry) UpsertSmtpServer(server SmtpServer) MailRegistry {
+	r.SmtpServers = upsertItem(r.SmtpServers, server)
+	return r
+}
+
+func (r MailRegistry) Validate() error {
+	return r.validate("").errorOrNil()
+}
+
+func (r MailRegistry) validate(path string) ValidationErrors {
+	errs := validateCollection(path, "smtpServers", "name", r.SmtpServers)
+	for i, s := range r.SmtpServers {
+		errs = append(errs, s.validate(itemPath(path, "smtpServers", s.Name, i))...)
+	}
+	return errs
+}
+
 type SecureMailRegistry struct {
 	SmtpServers  []SecureSmtpServer        `json:"smtpServers,omitempty" yaml:"smtpServers,omitempty" mapstructure:"smtpServers,omitempty" secure:"true"`
 	CryptoParams cryptostruct.CryptoParams `json:"cryptoParams" yaml:"cryptoParams" mapstructure:"cryptoParams"`
 }
 
+func (s SecureMailRegistry) Decrypt(key string) (MailRegistry, error) {
+	return decrypt[MailRegistry](key, s)
+}
+
 func (s SecureMailRegistry) GetCryptoParams() cryptostruct.CryptoParams {
 	return s.CryptoParams
 }
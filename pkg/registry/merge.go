@@ -0,0 +1,125 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"fmt"
+	"reflect"
+)
+
+func NewOverlay(r Registry, deletions ...string) Overlay {
+	return Overlay{
+		Registry:  r,
+		Deletions: deletions,
+	}
+}
+
+// Overlay holds the changes of a site-specific registry on top of a base registry
+type Overlay struct {
+	Registry  Registry `json:"registry,omitempty" yaml:"registry,omitempty" mapstructure:"registry,omitempty"`    // Items and fields layered on top of the base registry
+	Deletions []string `json:"deletions,omitempty" yaml:"deletions,omitempty" mapstructure:"deletions,omitempty"` // Paths removed from the base registry before the overlay registry is layered on top of it
+}
+
+// Merge layers the overlays on top of base, in order. For each overlay:
+//   - the deletion paths are removed first, deleting an item and adding it again in the overlay replaces the item as a whole,
+//     deleting a field resets it to its zero value
+//   - items in collections are matched by name, or by key for acme variables, and merged recursively
+//   - items which do not exist in base are appended to the collection
+//   - fields which are set in the overlay override the base, fields with a zero value in the overlay keep the base value
+//   - labels and annotations are merged by key, with the overlay value taking precedence
+//
+// Neither base nor the overlays are modified.
+func Merge(base Registry, overlays ...Overlay) (Registry, error) {
+	var err error
+
+	output := base
+	for i, overlay := range overlays {
+		for _, path := range overlay.Deletions {
+			if output, err = output.Delete(path); err != nil {
+				return Registry{}, fmt.Errorf("could not apply deletion %s of overlay %d: %w", path, i, err)
+			}
+		}
+		output = mergeValue(reflect.ValueOf(output), reflect.ValueOf(overlay.Registry)).Interface().(Registry)
+	}
+	return output, nil
+}
+
+func mergeValue(base reflect.Value, overlay reflect.Value) reflect.Value {
+	switch base.Kind() {
+	case reflect.Struct:
+		output := reflect.New(base.Type()).Elem()
+		for i := 0; i < base.NumField(); i++ {
+			if base.Type().Field(i).IsExported() {
+				output.Field(i).Set(mergeValue(base.Field(i), overlay.Field(i)))
+			}
+		}
+		return output
+	case reflect.Slice:
+		if base.Type().Elem().Kind() == reflect.Struct {
+			return mergeCollection(base, overlay)
+		}
+	case reflect.Map:
+		if overlay.Len() == 0 {
+			return base
+		}
+		output := reflect.MakeMapWithSize(base.Type(), base.Len()+overlay.Len())
+		for _, key := range base.MapKeys() {
+			output.SetMapIndex(key, base.MapIndex(key))
+		}
+		for _, key := range overlay.MapKeys() {
+			output.SetMapIndex(key, overlay.MapIndex(key))
+		}
+		return output
+	}
+
+	if overlay.IsZero() {
+		return base
+	}
+	return overlay
+}
+
+func mergeCollection(base reflect.Value, overlay reflect.Value) reflect.Value {
+	if overlay.Len() == 0 {
+		return base
+	}
+
+	overlayItems := make(map[string]reflect.Value, overlay.Len())
+	for i := 0; i < overlay.Len(); i++ {
+		overlayItems[itemNameField(overlay.Index(i)).String()] = overlay.Index(i)
+	}
+
+	output := reflect.MakeSlice(base.Type(), 0, base.Len()+overlay.Len())
+	merged := make(map[string]bool, overlay.Len())
+	for i := 0; i < base.Len(); i++ {
+		item := base.Index(i)
+		name := itemNameField(item).String()
+		if overlayItem, found := overlayItems[name]; found && !merged[name] {
+			item = mergeValue(item, overlayItem)
+			merged[name] = true
+		}
+		output = reflect.Append(output, item)
+	}
+
+	for i := 0; i < overlay.Len(); i++ {
+		name := itemNameField(overlay.Index(i)).String()
+		if !merged[name] {
+			output = reflect.Append(output, overlay.Index(i))
+			merged[name] = true
+		}
+	}
+	return output
+}
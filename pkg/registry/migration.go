@@ -0,0 +1,154 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"fmt"
+)
+
+const (
+	// CurrentSchemaVersion is the schema version written to registry files, files with a newer version cannot be loaded
+	CurrentSchemaVersion = 1
+
+	schemaVersionField = "schemaVersion"
+)
+
+// Migration upgrades a decoded registry file from schema version From to the next version.
+// Migrate works on the document as it is stored on disk, so it can move or rename fields which no longer exist in SecureRegistry.
+type Migration struct {
+	From        int
+	Description string
+	Migrate     func(document map[string]any) error
+}
+
+// migrations holds the chain of migrations registered with registerMigration, the migration at index i upgrades schema version i to i+1.
+// The chain is internal to the package: a new schema version bumps CurrentSchemaVersion and registers its migration in init.
+var migrations []Migration
+
+func init() {
+	mustRegisterMigration(Migration{
+		From:        0,
+		Description: "mark registry files written before the schema version was introduced",
+		Migrate:     func(document map[string]any) error { return nil },
+	})
+}
+
+// registerMigration appends a migration to the chain, migrations must be registered in order of schema version without gaps
+func registerMigration(m Migration) error {
+	if m.Migrate == nil {
+		return fmt.Errorf("migration from schema version %d has no migrate function", m.From)
+	}
+	if m.From != len(migrations) {
+		return fmt.Errorf("migration from schema version %d is out of order, expected a migration from schema version %d", m.From, len(migrations))
+	}
+	if m.From >= CurrentSchemaVersion {
+		return fmt.Errorf("migration from schema version %d upgrades beyond current schema version %d", m.From, CurrentSchemaVersion)
+	}
+	migrations = append(migrations, m)
+	return nil
+}
+
+func mustRegisterMigration(m Migration) {
+	if err := registerMigration(m); err != nil {
+		panic(err)
+	}
+}
+
+// GetMigrations returns the migrations which upgrade a registry file from schema version from to CurrentSchemaVersion
+func GetMigrations(from int) ([]Migration, error) {
+	if from > CurrentSchemaVersion {
+		return nil, fmt.Errorf("schema version %d is newer than supported version %d: %w", from, CurrentSchemaVersion, ErrUnsupportedSchemaVersion)
+	}
+	if from < 0 {
+		return nil, fmt.Errorf("invalid schema version %d: %w", from, ErrUnsupportedSchemaVersion)
+	}
+
+	output := make([]Migration, 0, CurrentSchemaVersion-from)
+	for version := from; version < CurrentSchemaVersion; version++ {
+		if version >= len(migrations) || migrations[version].From != version {
+			return nil, fmt.Errorf("could not find migration from schema version %d", version)
+		}
+		output = append(output, migrations[version])
+	}
+	return output, nil
+}
+
+// MigrateDocument upgrades a decoded registry file to CurrentSchemaVersion in place.
+// A missing schema version is version 0, for files written before the schema version was introduced.
+func MigrateDocument(document map[string]any) error {
+	var (
+		err     error
+		version int
+		chain   []Migration
+	)
+
+	if version, err = getSchemaVersion(document); err != nil {
+		return err
+	}
+	if chain, err = GetMigrations(version); err != nil {
+		return err
+	}
+	for _, m := range chain {
+		if err = m.Migrate(document); err != nil {
+			return fmt.Errorf("could not migrate from schema version %d (%s): %w", m.From, m.Description, err)
+		}
+		document[schemaVersionField] = m.From + 1
+	}
+	return nil
+}
+
+func getSchemaVersion(document map[string]any) (int, error) {
+	switch version := document[schemaVersionField].(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return version, nil
+	case float64:
+		// JSON numbers are decoded as float64
+		if version == float64(int(version)) {
+			return int(version), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid schema version %v: %w", document[schemaVersionField], ErrUnsupportedSchemaVersion)
+}
+
+// migrateData upgrades the contents of a registry file to CurrentSchemaVersion, keeping the format.
+// Files which are already at CurrentSchemaVersion are returned as they are.
+func migrateData(data []byte, f Format) ([]byte, error) {
+	var (
+		err    error
+		header struct {
+			SchemaVersion int `json:"schemaVersion" yaml:"schemaVersion"`
+		}
+		document map[string]any
+	)
+
+	if err = unmarshal(data, &header, f); err == nil && header.SchemaVersion == CurrentSchemaVersion {
+		return data, nil
+	}
+
+	if err = unmarshal(data, &document, f); err != nil {
+		return nil, err
+	}
+	if document == nil {
+		document = make(map[string]any)
+	}
+	if err = MigrateDocument(document); err != nil {
+		return nil, err
+	}
+	return marshal(document, f)
+}
@@ -0,0 +1,143 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrationChain(t *testing.T) {
+	if len(migrations) != CurrentSchemaVersion {
+		t.Fatalf("found %d migrations, want one for every schema version below %d", len(migrations), CurrentSchemaVersion)
+	}
+	for version := 0; version <= CurrentSchemaVersion; version++ {
+		chain, err := GetMigrations(version)
+		if err != nil {
+			t.Fatalf("GetMigrations(%d) returned error: %v", version, err)
+		}
+		if len(chain) != CurrentSchemaVersion-version {
+			t.Errorf("GetMigrations(%d) returned %d migrations, want %d", version, len(chain), CurrentSchemaVersion-version)
+		}
+	}
+}
+
+func TestRegisterMigration(t *testing.T) {
+	registered := migrations
+	t.Cleanup(func() { migrations = registered })
+
+	noop := func(document map[string]any) error { return nil }
+	tests := map[string]struct {
+		chain     []Migration
+		migration Migration
+	}{
+		"duplicate":      {chain: registered, migration: Migration{From: len(registered) - 1, Migrate: noop}},
+		"gap":            {chain: nil, migration: Migration{From: 1, Migrate: noop}},
+		"out of order":   {chain: nil, migration: Migration{From: -1, Migrate: noop}},
+		"beyond current": {chain: registered, migration: Migration{From: CurrentSchemaVersion, Migrate: noop}},
+		"no function":    {chain: nil, migration: Migration{From: 0}},
+	}
+	for name, tt := range tests {
+		migrations = tt.chain
+		if err := registerMigration(tt.migration); err == nil {
+			t.Errorf("registerMigration with %s migration returned no error", name)
+		}
+		if len(migrations) != len(tt.chain) {
+			t.Errorf("registerMigration with %s migration changed the chain", name)
+		}
+	}
+
+	migrations = nil
+	if err := registerMigration(Migration{From: 0, Migrate: noop}); err != nil {
+		t.Errorf("registerMigration returned error: %v", err)
+	}
+}
+
+func TestMigrateDocument(t *testing.T) {
+	document := map[string]any{}
+	if err := MigrateDocument(document); err != nil {
+		t.Fatalf("MigrateDocument without schema version returned error: %v", err)
+	}
+	if document[schemaVersionField] != CurrentSchemaVersion {
+		t.Errorf("MigrateDocument set schema version %v, want %d", document[schemaVersionField], CurrentSchemaVersion)
+	}
+
+	for _, version := range []any{CurrentSchemaVersion + 1, float64(CurrentSchemaVersion + 1), -1, 1.5, "1"} {
+		document = map[string]any{schemaVersionField: version}
+		if err := MigrateDocument(document); !errors.Is(err, ErrUnsupportedSchemaVersion) {
+			t.Errorf("MigrateDocument with schema version %v returned %v, want %v", version, err, ErrUnsupportedSchemaVersion)
+		}
+	}
+}
+
+func TestLoaderNewerSchemaVersion(t *testing.T) {
+	var (
+		err      error
+		data     []byte
+		document map[string]any
+	)
+
+	for _, format := range []Format{FormatYaml, FormatJson} {
+		l := NewLoader(filepath.Join(t.TempDir(), "registry."+string(format)))
+		k := NewKeyring("test key")
+		if err = l.SaveWithKeyring(k, Registry{Organizations: []Organization{NewOrganization("a")}}); err != nil {
+			t.Fatalf("SaveWithKeyring returned error: %v", err)
+		}
+
+		// Simulate a registry file written by a newer release
+		if data, err = os.ReadFile(l.Path); err != nil {
+			t.Fatalf("could not read registry file: %v", err)
+		}
+		if err = unmarshal(data, &document, format); err != nil {
+			t.Fatalf("could not parse registry file: %v", err)
+		}
+		document[schemaVersionField] = CurrentSchemaVersion + 1
+		if data, err = marshal(document, format); err != nil {
+			t.Fatalf("could not serialize registry file: %v", err)
+		}
+		if err = os.WriteFile(l.Path, data, DefaultFileMode); err != nil {
+			t.Fatalf("could not write registry file: %v", err)
+		}
+
+		if _, err = l.LoadSecure(); !errors.Is(err, ErrUnsupportedSchemaVersion) {
+			t.Errorf("%s: LoadSecure returned %v, want %v", format, err, ErrUnsupportedSchemaVersion)
+		}
+		if _, _, err = l.LoadWithKeyring(k); !errors.Is(err, ErrUnsupportedSchemaVersion) {
+			t.Errorf("%s: LoadWithKeyring returned %v, want %v", format, err, ErrUnsupportedSchemaVersion)
+		}
+
+		// Saving must not downgrade the registry file to the current schema version
+		r := Registry{Organizations: []Organization{NewOrganization("b")}}
+		if err = l.SaveWithKeyring(k, r); !errors.Is(err, ErrUnsupportedSchemaVersion) {
+			t.Errorf("%s: SaveWithKeyring returned %v, want %v", format, err, ErrUnsupportedSchemaVersion)
+		}
+		if err = l.ReplaceWithKeyring(k, r); !errors.Is(err, ErrUnsupportedSchemaVersion) {
+			t.Errorf("%s: ReplaceWithKeyring returned %v, want %v", format, err, ErrUnsupportedSchemaVersion)
+		}
+
+		written, err := os.ReadFile(l.Path)
+		if err != nil {
+			t.Fatalf("could not read registry file: %v", err)
+		}
+		if !bytes.Equal(written, data) {
+			t.Errorf("%s: saving changed the registry file with a newer schema version", format)
+		}
+	}
+}
@@ -17,8 +17,6 @@
 package registry
 
 import (
-	"encoding/hex"
-
 	"github.com/corelayer/go-cryptostruct/pkg/cryptostruct"
 )
 
@@ -30,8 +28,14 @@ func NewNetScalerAdcNode(name string, address string) NetScalerAdcNode {
 }
 
 type NetScalerAdcNode struct {
-	Name    string `json:"name,omitempty" yaml:"name,omitempty" mapstructure:"name,omitempty" secure:"false"`
-	Address string `json:"address,omitempty" yaml:"address,omitempty" mapstructure:"address,omitempty" secure:"true"`
+	Name        string            `json:"name,omitempty" yaml:"name,omitempty" mapstructure:"name,omitempty" secure:"false"`
+	Labels      map[string]string `json:"labels,omitempty" yaml:"labels,omitempty" mapstructure:"labels,omitempty" secure:"false"`
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty" mapstructure:"annotations,omitempty" secure:"false"`
+	Address     string            `json:"address,omitempty" yaml:"address,omitempty" mapstructure:"address,omitempty" secure:"true"`
+}
+
+func (n NetScalerAdcNode) Encrypt(key string) (SecureNetScalerAdcNode, error) {
+	return encrypt[SecureNetScalerAdcNode](key, DefaultCipherSuite, n)
 }
 
 func (n NetScalerAdcNode) GetTransformConfig() cryptostruct.TransformConfig {
@@ -41,22 +45,34 @@ func (n NetScalerAdcNode) GetTransformConfig() cryptostruct.TransformConfig {
 	}
 }
 
+func (n NetScalerAdcNode) Validate() error {
+	return n.validate("").errorOrNil()
+}
+
+func (n NetScalerAdcNode) itemName() string {
+	return n.Name
+}
+
+func (n NetScalerAdcNode) validate(path string) ValidationErrors {
+	errs := validateLabels(path, n.Labels, n.Annotations)
+	if n.Address == "" {
+		errs.add(fieldPath(path, "address"), "address is required")
+	} else if !isValidHost(n.Address) {
+		errs.add(fieldPath(path, "address"), "address is not a valid ip address or hostname")
+	}
+	return errs
+}
+
 type SecureNetScalerAdcNode struct {
 	Name         string                    `json:"name,omitempty" yaml:"name,omitempty" mapstructure:"name,omitempty" secure:"false"`
+	Labels       map[string]string         `json:"labels,omitempty" yaml:"labels,omitempty" mapstructure:"labels,omitempty" secure:"false"`
+	Annotations  map[string]string         `json:"annotations,omitempty" yaml:"annotations,omitempty" mapstructure:"annotations,omitempty" secure:"false"`
 	Address      string                    `json:"address,omitempty" yaml:"address,omitempty" mapstructure:"address,omitempty" secure:"true"`
 	CryptoParams cryptostruct.CryptoParams `json:"cryptoParams" yaml:"cryptoParams" mapstructure:"cryptoParams"`
 }
 
 func (s SecureNetScalerAdcNode) Decrypt(key string) (NetScalerAdcNode, error) {
-	var (
-		err       error
-		decrypted any
-	)
-	decrypter := cryptostruct.NewDecrypter(hex.EncodeToString([]byte(key)), s.GetTransformConfig())
-	if decrypted, err = decrypter.Transform(s); err != nil {
-		return NetScalerAdcNode{}, err
-	}
-	return decrypted.(NetScalerAdcNode), nil
+	return decrypt[NetScalerAdcNode](key, s)
 }
 
 func (s SecureNetScalerAdcNode) GetCryptoParams() cryptostruct.CryptoParams {
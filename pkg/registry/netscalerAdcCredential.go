@@ -17,8 +17,6 @@
 package registry
 
 import (
-	"encoding/hex"
-
 	"github.com/corelayer/go-cryptostruct/pkg/cryptostruct"
 )
 
@@ -36,6 +34,10 @@ type NetScalerAdcCredential struct {
 	Password string `json:"password,omitempty" yaml:"password,omitempty" mapstructure:"password,omitempty" secure:"true"`
 }
 
+func (c NetScalerAdcCredential) Encrypt(key string) (SecureNetScalerAdcCredential, error) {
+	return encrypt[SecureNetScalerAdcCredential](key, DefaultCipherSuite, c)
+}
+
 func (c NetScalerAdcCredential) GetTransformConfig() cryptostruct.TransformConfig {
 	return cryptostruct.TransformConfig{
 		Decrypted: NetScalerAdcCredential{},
@@ -43,6 +45,25 @@ func (c NetScalerAdcCredential) GetTransformConfig() cryptostruct.TransformConfi
 	}
 }
 
+func (c NetScalerAdcCredential) Validate() error {
+	return c.validate("").errorOrNil()
+}
+
+func (c NetScalerAdcCredential) itemName() string {
+	return c.Name
+}
+
+func (c NetScalerAdcCredential) validate(path string) ValidationErrors {
+	var errs ValidationErrors
+	if c.Username == "" {
+		errs.add(fieldPath(path, "username"), "username is required")
+	}
+	if c.Password == "" {
+		errs.add(fieldPath(path, "password"), "password is required")
+	}
+	return errs
+}
+
 type SecureNetScalerAdcCredential struct {
 	Name         string                    `json:"name,omitempty" yaml:"name,omitempty" mapstructure:"name,omitempty" secure:"false"`
 	Username     string                    `json:"username,omitempty" yaml:"username,omitempty" mapstructure:"username,omitempty" secure:"true"`
@@ -51,15 +72,7 @@ type SecureNetScalerAdcCredential struct {
 }
 
 func (s SecureNetScalerAdcCredential) Decrypt(key string) (NetScalerAdcCredential, error) {
-	var (
-		err       error
-		decrypted any
-	)
-	decrypter := cryptostruct.NewDecrypter(hex.EncodeToString([]byte(key)), s.GetTransformConfig())
-	if decrypted, err = decrypter.Transform(s); err != nil {
-		return NetScalerAdcCredential{}, err
-	}
-	return decrypted.(NetScalerAdcCredential), nil
+	return decrypt[NetScalerAdcCredential](key, s)
 }
 
 func (s SecureNetScalerAdcCredential) GetCryptoParams() cryptostruct.CryptoParams {
@@ -27,11 +27,35 @@ import (
 )
 
 type NetScalerAdcEnvironment struct {
-	Name        string                   `json:"name,omitempty" yaml:"name,omitempty" mapstructure:"name,omitempty" secure:"false"`                     // Target environment name, such as "Production"
-	Management  NetScalerAdcNode         `json:"management,omitempty" yaml:"management,omitempty" mapstructure:"management,omitempty" secure:"true"`    // Connection details for the Management Address (SNIP / Cluster IP) of the environment
-	Nodes       []NetScalerAdcNode       `json:"nodes,omitempty" yaml:"nodes,omitempty" mapstructure:"nodes,omitempty" secure:"true"`                   // Connection details for the individual Nodes of each node
-	Credentials []NetScalerAdcCredential `json:"credentials,omitempty" yaml:"credentials,omitempty" mapstructure:"credentials,omitempty" secure:"true"` // Connection credentials
-	Settings    NetScalerAdcSettings     `json:"settings,omitempty" yaml:"settings,omitempty" mapstructure:"settings,omitempty" secure:"false"`         // Connection settings for Nitro Client
+	Name        string                   `json:"name,omitempty" yaml:"name,omitempty" mapstructure:"name,omitempty" secure:"false"`                      // Target environment name, such as "Production"
+	Labels      map[string]string        `json:"labels,omitempty" yaml:"labels,omitempty" mapstructure:"labels,omitempty" secure:"false"`                // Labels to select the environment, such as region or lifecycle
+	Annotations map[string]string        `json:"annotations,omitempty" yaml:"annotations,omitempty" mapstructure:"annotations,omitempty" secure:"false"` // Non-identifying metadata
+	Management  NetScalerAdcNode         `json:"management,omitempty" yaml:"management,omitempty" mapstructure:"management,omitempty" secure:"true"`     // Connection details for the Management Address (SNIP / Cluster IP) of the environment
+	Nodes       []NetScalerAdcNode       `json:"nodes,omitempty" yaml:"nodes,omitempty" mapstructure:"nodes,omitempty" secure:"true"`                    // Connection details for the individual Nodes of each node
+	Credentials []NetScalerAdcCredential `json:"credentials,omitempty" yaml:"credentials,omitempty" mapstructure:"credentials,omitempty" secure:"true"`  // Connection credentials
+	Settings    NetScalerAdcSettings     `json:"settings,omitempty" yaml:"settings,omitempty" mapstructure:"settings,omitempty" secure:"false"`          // Connection settings for Nitro Client
+}
+
+func (e NetScalerAdcEnvironment) AddCredential(credential NetScalerAdcCredential) (NetScalerAdcEnvironment, error) {
+	credentials, err := addItem(e.Credentials, credential, "netscaler adc credential", e.path())
+	if err != nil {
+		return e, err
+	}
+	e.Credentials = credentials
+	return e, nil
+}
+
+func (e NetScalerAdcEnvironment) AddNode(node NetScalerAdcNode) (NetScalerAdcEnvironment, error) {
+	nodes, err := addItem(e.Nodes, node, "netscaler adc node", e.path())
+	if err != nil {
+		return e, err
+	}
+	e.Nodes = nodes
+	return e, nil
+}
+
+func (e NetScalerAdcEnvironment) Encrypt(key string) (SecureNetScalerAdcEnvironment, error) {
+	return encrypt[SecureNetScalerAdcEnvironment](key, DefaultCipherSuite, e)
 }
 
 func (e NetScalerAdcEnvironment) GetTransformConfig() cryptostruct.TransformConfig {
@@ -47,7 +71,7 @@ func (e NetScalerAdcEnvironment) GetCredentialByName(name string) (NetScalerAdcC
 			return c, nil
 		}
 	}
-	return NetScalerAdcCredential{}, fmt.Errorf("could not find credential %s in environment %s", name, e.Name)
+	return NetScalerAdcCredential{}, NewItemNotFoundError("netscaler adc credential", name).WithParent(e.path())
 }
 
 func (e NetScalerAdcEnvironment) GetNodeScpClient(nodeName string, credential NetScalerAdcCredential, f ssh.HostKeyCallback) (scp.Client, error) {
@@ -66,7 +90,7 @@ func (e NetScalerAdcEnvironment) GetNodeScpClient(nodeName string, credential Ne
 			return scp.NewClient(n.Address+":22", &clientConfig), nil
 		}
 	}
-	return scp.Client{}, fmt.Errorf("could not intialize scp client")
+	return scp.Client{}, fmt.Errorf("could not intialize scp client for node %s: %w", nodeName, NewItemNotFoundError("netscaler adc node", nodeName).WithParent(e.path()))
 }
 
 func (e NetScalerAdcEnvironment) GetNodeNitroClient(nodeName string, credential NetScalerAdcCredential) (*nitro.Client, error) {
@@ -99,14 +123,13 @@ func (e NetScalerAdcEnvironment) GetNodeNitroClient(nodeName string, credential
 			return client, nil
 		}
 	}
-	return nil, fmt.Errorf("could not create client for node %s with error: node not found in environment %s", nodeName, e.Name)
+	return nil, fmt.Errorf("could not create client for node %s: %w", nodeName, NewItemNotFoundError("netscaler adc node", nodeName).WithParent(e.path()))
 }
 
 func (e NetScalerAdcEnvironment) GetManagementClient(credential NetScalerAdcCredential) (*nitro.Client, error) {
 	// Return the SNIP Node if defined in the environment
 	if !e.HasManagement() {
-		return nil, fmt.Errorf("no management node defined for environment %s", e.Name)
-
+		return nil, fmt.Errorf("could not create client for environment %s: %w", e.Name, ErrNoManagementNode)
 	}
 
 	nitroCredential := nitro.Credentials{
@@ -165,7 +188,7 @@ func (e NetScalerAdcEnvironment) GetPrimaryClient(credential NetScalerAdcCredent
 	}
 
 	if !e.HasNodes() {
-		return nil, fmt.Errorf("no individual nodes defined for environment %s", e.Name)
+		return nil, fmt.Errorf("no individual nodes defined for environment %s: %w", e.Name, ErrNoPrimaryNode)
 	}
 
 	// Loop over individual nodes to determine which one is primary
@@ -185,7 +208,7 @@ func (e NetScalerAdcEnvironment) GetPrimaryClient(credential NetScalerAdcCredent
 		}
 	}
 
-	return nil, fmt.Errorf("could not find a primary node for environment %s", e.Name)
+	return nil, fmt.Errorf("could not find a primary node for environment %s: %w", e.Name, ErrNoPrimaryNode)
 }
 
 func (e NetScalerAdcEnvironment) HasNodes() bool {
@@ -196,29 +219,116 @@ func (e NetScalerAdcEnvironment) HasNodes() bool {
 }
 
 func (e NetScalerAdcEnvironment) HasManagement() bool {
-	emptyNode := NetScalerAdcNode{}
-	if e.Management != emptyNode {
+	// Labels and annotations alone do not define a management node
+	if e.Management.Name != "" || e.Management.Address != "" {
 		return true
 	}
 	return false
 }
 
+func (e NetScalerAdcEnvironment) RemoveCredential(name string) (NetScalerAdcEnvironment, error) {
+	credentials, err := removeItem(e.Credentials, name, "netscaler adc credential", e.path())
+	if err != nil {
+		return e, err
+	}
+	e.Credentials = credentials
+	return e, nil
+}
+
+func (e NetScalerAdcEnvironment) RemoveNode(name string) (NetScalerAdcEnvironment, error) {
+	nodes, err := removeItem(e.Nodes, name, "netscaler adc node", e.path())
+	if err != nil {
+		return e, err
+	}
+	e.Nodes = nodes
+	return e, nil
+}
+
+func (e NetScalerAdcEnvironment) UpdateCredential(credential NetScalerAdcCredential) (NetScalerAdcEnvironment, error) {
+	credentials, err := updateItem(e.Credentials, credential, "netscaler adc credential", e.path())
+	if err != nil {
+		return e, err
+	}
+	e.Credentials = credentials
+	return e, nil
+}
+
+func (e NetScalerAdcEnvironment) UpdateNode(node NetScalerAdcNode) (NetScalerAdcEnvironment, error) {
+	nodes, err := updateItem(e.Nodes, node, "netscaler adc node", e.path())
+	if err != nil {
+		return e, err
+	}
+	e.Nodes = nodes
+	return e, nil
+}
+
+func (e NetScalerAdcEnvironment) UpsertCredential(credential NetScalerAdcCredential) NetScalerAdcEnvironment {
+	e.Credentials = upsertItem(e.Credentials, credential)
+	return e
+}
+
+func (e NetScalerAdcEnvironment) UpsertNode(node NetScalerAdcNode) NetScalerAdcEnvironment {
+	e.Nodes = upsertItem(e.Nodes, node)
+	return e
+}
+
+func (e NetScalerAdcEnvironment) Validate() error {
+	return e.validate("").errorOrNil()
+}
+
+func (e NetScalerAdcEnvironment) itemName() string {
+	return e.Name
+}
+
+// path returns the path of the environment in its collection, used as parent in errors for its nodes and credentials
+func (e NetScalerAdcEnvironment) path() string {
+	return itemPath("", "environments", e.Name, 0)
+}
+
+func (e NetScalerAdcEnvironment) validate(path string) ValidationErrors {
+	errs := validateLabels(path, e.Labels, e.Annotations)
+	if !e.HasManagement() && !e.HasNodes() {
+		errs.add(path, "environment has no management node and no nodes")
+	}
+	if e.HasManagement() {
+		errs = append(errs, e.Management.validate(childPath(path, "management"))...)
+	}
+
+	errs = append(errs, validateCollection(path, "nodes", "name", e.Nodes)...)
+	for i, n := range e.Nodes {
+		errs = append(errs, n.validate(itemPath(path, "nodes", n.Name, i))...)
+	}
+
+	errs = append(errs, validateCollection(path, "credentials", "name", e.Credentials)...)
+	for i, c := range e.Credentials {
+		errs = append(errs, c.validate(itemPath(path, "credentials", c.Name, i))...)
+	}
+
+	return append(errs, e.Settings.validate(childPath(path, "settings"))...)
+}
+
 type SecureNetScalerAdcEnvironment struct {
-	Name         string                         `json:"name,omitempty" yaml:"name,omitempty" mapstructure:"name,omitempty" secure:"false"`                     // Target environment name, such as "Production"
-	Management   SecureNetScalerAdcNode         `json:"management,omitempty" yaml:"management,omitempty" mapstructure:"management,omitempty" secure:"true"`    // Connection details for the Management Address (SNIP / Cluster IP) of the environment
-	Nodes        []SecureNetScalerAdcNode       `json:"nodes,omitempty" yaml:"nodes,omitempty" mapstructure:"nodes,omitempty" secure:"true"`                   // Connection details for the individual Nodes of each node
-	Credentials  []SecureNetScalerAdcCredential `json:"credentials,omitempty" yaml:"credentials,omitempty" mapstructure:"credentials,omitempty" secure:"true"` // Connection credentials
-	Settings     NetScalerAdcSettings           `json:"settings,omitempty" yaml:"settings,omitempty" mapstructure:"settings,omitempty" secure:"false"`         // Connection settings for Nitro Client
+	Name         string                         `json:"name,omitempty" yaml:"name,omitempty" mapstructure:"name,omitempty" secure:"false"`                      // Target environment name, such as "Production"
+	Labels       map[string]string              `json:"labels,omitempty" yaml:"labels,omitempty" mapstructure:"labels,omitempty" secure:"false"`                // Labels to select the environment, such as region or lifecycle
+	Annotations  map[string]string              `json:"annotations,omitempty" yaml:"annotations,omitempty" mapstructure:"annotations,omitempty" secure:"false"` // Non-identifying metadata
+	Management   SecureNetScalerAdcNode         `json:"management,omitempty" yaml:"management,omitempty" mapstructure:"management,omitempty" secure:"true"`     // Connection details for the Management Address (SNIP / Cluster IP) of the environment
+	Nodes        []SecureNetScalerAdcNode       `json:"nodes,omitempty" yaml:"nodes,omitempty" mapstructure:"nodes,omitempty" secure:"true"`                    // Connection details for the individual Nodes of each node
+	Credentials  []SecureNetScalerAdcCredential `json:"credentials,omitempty" yaml:"credentials,omitempty" mapstructure:"credentials,omitempty" secure:"true"`  // Connection credentials
+	Settings     NetScalerAdcSettings           `json:"settings,omitempty" yaml:"settings,omitempty" mapstructure:"settings,omitempty" secure:"false"`          // Connection settings for Nitro Client
 	CryptoParams cryptostruct.CryptoParams      `json:"cryptoParams" yaml:"cryptoParams" mapstructure:"cryptoParams"`
 }
 
+func (s SecureNetScalerAdcEnvironment) Decrypt(key string) (NetScalerAdcEnvironment, error) {
+	return decrypt[NetScalerAdcEnvironment](key, s)
+}
+
 func (e SecureNetScalerAdcEnvironment) GetCredentialByName(name string) (SecureNetScalerAdcCredential, error) {
 	for _, c := range e.Credentials {
 		if c.Name == name {
 			return c, nil
 		}
 	}
-	return SecureNetScalerAdcCredential{}, fmt.Errorf("could not find credential %s in environment %s", name, e.Name)
+	return SecureNetScalerAdcCredential{}, NewItemNotFoundError("netscaler adc credential", name).WithParent(itemPath("", "environments", e.Name, 0))
 }
 
 func (s SecureNetScalerAdcEnvironment) GetCryptoParams() cryptostruct.CryptoParams {
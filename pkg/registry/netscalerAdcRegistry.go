@@ -30,6 +30,19 @@ type NetScalerAdcRegistry struct {
 	Environments []NetScalerAdcEnvironment `json:"environments,omitempty" yaml:"environments,omitempty" mapstructure:"environments,omitempty" secure:"true"`
 }
 
+func (r NetScalerAdcRegistry) AddEnvironment(environment NetScalerAdcEnvironment) (NetScalerAdcRegistry, error) {
+	environments, err := addItem(r.Environments, environment, "netscaler adc environment", "")
+	if err != nil {
+		return r, err
+	}
+	r.Environments = environments
+	return r, nil
+}
+
+func (r NetScalerAdcRegistry) Encrypt(key string) (SecureNetScalerAdcRegistry, error) {
+	return encrypt[SecureNetScalerAdcRegistry](key, DefaultCipherSuite, r)
+}
+
 func (r NetScalerAdcRegistry) GetEnvironmentByName(name string) (NetScalerAdcEnvironment, error) {
 	for _, e := range r.Environments {
 		if e.Name == name {
@@ -54,11 +67,50 @@ func (r NetScalerAdcRegistry) GetTransformConfig() cryptostruct.TransformConfig
 	}
 }
 
+func (r NetScalerAdcRegistry) RemoveEnvironment(name string) (NetScalerAdcRegistry, error) {
+	environments, err := removeItem(r.Environments, name, "netscaler adc environment", "")
+	if err != nil {
+		return r, err
+	}
+	r.Environments = environments
+	return r, nil
+}
+
+func (r NetScalerAdcRegistry) UpdateEnvironment(environment NetScalerAdcEnvironment) (NetScalerAdcRegistry, error) {
+	environments, err := updateItem(r.Environments, environment, "netscaler adc environment", "")
+	if err != nil {
+		return r, err
+	}
+	r.Environments = environments
+	return r, nil
+}
+
+func (r NetScalerAdcRegistry) UpsertEnvironment(environment NetScalerAdcEnvironment) NetScalerAdcRegistry {
+	r.Environments = upsertItem(r.Environments, environment)
+	return r
+}
+
+func (r NetScalerAdcRegistry) Validate() error {
+	return r.validate("").errorOrNil()
+}
+
+func (r NetScalerAdcRegistry) validate(path string) ValidationErrors {
+	errs := validateCollection(path, "environments", "name", r.Environments)
+	for i, e := range r.Environments {
+		errs = append(errs, e.validate(itemPath(path, "environments", e.Name, i))...)
+	}
+	return errs
+}
+
 type SecureNetScalerAdcRegistry struct {
 	Environments []SecureNetScalerAdcEnvironment `json:"environments,omitempty" yaml:"environments,omitempty" mapstructure:"environments,omitempty" secure:"true"`
 	CryptoParams cryptostruct.CryptoParams       `json:"cryptoParams" yaml:"cryptoParams" mapstructure:"cryptoParams"`
 }
 
+func (s SecureNetScalerAdcRegistry) Decrypt(key string) (NetScalerAdcRegistry, error) {
+	return decrypt[NetScalerAdcRegistry](key, s)
+}
+
 func (s SecureNetScalerAdcRegistry) GetCryptoParams() cryptostruct.CryptoParams {
 	return s.CryptoParams
 }
@@ -38,3 +38,18 @@ type NetScalerAdcSettings struct {
 	LogTlsSecretsDestination  string `json:"logTlsSecretsDestination,omitempty" yaml:"logTlsSecretsDestination,omitempty" mapstructure:"logTlsSecretsDestination,omitempty"`
 	AutoLogin                 bool   `json:"autoLogin,omitempty" yaml:"autoLogin,omitempty" mapstructure:"autoLogin,omitempty"`
 }
+
+func (s NetScalerAdcSettings) Validate() error {
+	return s.validate("").errorOrNil()
+}
+
+func (s NetScalerAdcSettings) validate(path string) ValidationErrors {
+	var errs ValidationErrors
+	if s.Timeout < 0 {
+		errs.add(fieldPath(path, "timeout"), "timeout must not be negative")
+	}
+	if s.LogTlsSecrets && s.LogTlsSecretsDestination == "" {
+		errs.add(fieldPath(path, "logTlsSecretsDestination"), "logTlsSecretsDestination is required when logTlsSecrets is enabled")
+	}
+	return errs
+}
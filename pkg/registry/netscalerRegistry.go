@@ -32,6 +32,10 @@ type NetScalerRegistry struct {
 	Sdx NetScalerSdxRegistry `json:"sdx,omitempty" yaml:"sdx,omitempty" mapstructure:"sdx,omitempty" secure:"true"`
 }
 
+func (r NetScalerRegistry) Encrypt(key string) (SecureNetScalerRegistry, error) {
+	return encrypt[SecureNetScalerRegistry](key, DefaultCipherSuite, r)
+}
+
 func (r NetScalerRegistry) GetTransformConfig() cryptostruct.TransformConfig {
 	return cryptostruct.TransformConfig{
 		Decrypted: NetScalerRegistry{},
@@ -39,12 +43,27 @@ func (r NetScalerRegistry) GetTransformConfig() cryptostruct.TransformConfig {
 	}
 }
 
+func (r NetScalerRegistry) Validate() error {
+	return r.validate("").errorOrNil()
+}
+
+func (r NetScalerRegistry) validate(path string) ValidationErrors {
+	var errs ValidationErrors
+	errs = append(errs, r.Adc.validate(childPath(path, "adc"))...)
+	errs = append(errs, r.Sdx.validate(childPath(path, "sdx"))...)
+	return errs
+}
+
 type SecureNetScalerRegistry struct {
 	Adc          SecureNetScalerAdcRegistry `json:"adc,omitempty" yaml:"adc,omitempty" mapstructure:"adc,omitempty" secure:"true"`
 	Sdx          SecureNetScalerSdxRegistry `json:"sdx,omitempty" yaml:"sdx,omitempty" mapstructure:"sdx,omitempty" secure:"true"`
 	CryptoParams cryptostruct.CryptoParams  `json:"cryptoParams" yaml:"cryptoParams" mapstructure:"cryptoParams"`
 }
 
+func (s SecureNetScalerRegistry) Decrypt(key string) (NetScalerRegistry, error) {
+	return decrypt[NetScalerRegistry](key, s)
+}
+
 func (s SecureNetScalerRegistry) GetCryptoParams() cryptostruct.CryptoParams {
 	return s.CryptoParams
 }
@@ -28,6 +28,10 @@ type NetScalerSdxRegistry struct {
 	// Environments []Environment `json:"environments" yaml:"environments" mapstructure:"environments" secure:"true"`
 }
 
+func (r NetScalerSdxRegistry) Encrypt(key string) (SecureNetScalerSdxRegistry, error) {
+	return encrypt[SecureNetScalerSdxRegistry](key, DefaultCipherSuite, r)
+}
+
 func (r NetScalerSdxRegistry) GetTransformConfig() cryptostruct.TransformConfig {
 	return cryptostruct.TransformConfig{
 		Decrypted: NetScalerSdxRegistry{},
@@ -35,10 +39,22 @@ func (r NetScalerSdxRegistry) GetTransformConfig() cryptostruct.TransformConfig
 	}
 }
 
+func (r NetScalerSdxRegistry) Validate() error {
+	return r.validate("").errorOrNil()
+}
+
+func (r NetScalerSdxRegistry) validate(path string) ValidationErrors {
+	return nil
+}
+
 type SecureNetScalerSdxRegistry struct {
 	CryptoParams cryptostruct.CryptoParams `json:"cryptoParams" yaml:"cryptoParams" mapstructure:"cryptoParams"`
 }
 
+func (s SecureNetScalerSdxRegistry) Decrypt(key string) (NetScalerSdxRegistry, error) {
+	return decrypt[NetScalerSdxRegistry](key, s)
+}
+
 func (s SecureNetScalerSdxRegistry) GetCryptoParams() cryptostruct.CryptoParams {
 	return s.CryptoParams
 }
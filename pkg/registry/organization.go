@@ -28,8 +28,14 @@ func NewOrganization(name string) Organization {
 }
 
 type Organization struct {
-	Name     string               `json:"name" yaml:"name" mapstructure:"name" secure:"false"`
-	Registry OrganizationRegistry `json:"registry,omitempty" yaml:"registry,omitempty" mapstructure:"registry,omitempty" secure:"true"`
+	Name        string               `json:"name" yaml:"name" mapstructure:"name" secure:"false"`
+	Labels      map[string]string    `json:"labels,omitempty" yaml:"labels,omitempty" mapstructure:"labels,omitempty" secure:"false"`
+	Annotations map[string]string    `json:"annotations,omitempty" yaml:"annotations,omitempty" mapstructure:"annotations,omitempty" secure:"false"`
+	Registry    OrganizationRegistry `json:"registry,omitempty" yaml:"registry,omitempty" mapstructure:"registry,omitempty" secure:"true"`
+}
+
+func (o Organization) Encrypt(key string) (SecureOrganization, error) {
+	return encrypt[SecureOrganization](key, DefaultCipherSuite, o)
 }
 
 func (o Organization) GetTransformConfig() cryptostruct.TransformConfig {
@@ -39,12 +45,31 @@ func (o Organization) GetTransformConfig() cryptostruct.TransformConfig {
 	}
 }
 
+func (o Organization) Validate() error {
+	return o.validate("").errorOrNil()
+}
+
+func (o Organization) itemName() string {
+	return o.Name
+}
+
+func (o Organization) validate(path string) ValidationErrors {
+	errs := validateLabels(path, o.Labels, o.Annotations)
+	return append(errs, o.Registry.validate(path)...)
+}
+
 type SecureOrganization struct {
 	Name         string                     `json:"name" yaml:"name" mapstructure:"name" secure:"false"`
+	Labels       map[string]string          `json:"labels,omitempty" yaml:"labels,omitempty" mapstructure:"labels,omitempty" secure:"false"`
+	Annotations  map[string]string          `json:"annotations,omitempty" yaml:"annotations,omitempty" mapstructure:"annotations,omitempty" secure:"false"`
 	Registry     SecureOrganizationRegistry `json:"registry,omitempty" yaml:"registry,omitempty" mapstructure:"registry,omitempty" secure:"true"`
 	CryptoParams cryptostruct.CryptoParams  `json:"cryptoParams" yaml:"cryptoParams" mapstructure:"cryptoParams"`
 }
 
+func (s SecureOrganization) Decrypt(key string) (Organization, error) {
+	return decrypt[Organization](key, s)
+}
+
 func (s SecureOrganization) GetCryptoParams() cryptostruct.CryptoParams {
 	return s.CryptoParams
 }
@@ -34,6 +34,10 @@ type OrganizationRegistry struct {
 	Mail         MailRegistry        `json:"mail,omitempty" yaml:"mail,omitempty" mapstructure:"mail,omitempty" secure:"true"`
 }
 
+func (c OrganizationRegistry) Encrypt(key string) (SecureOrganizationRegistry, error) {
+	return encrypt[SecureOrganizationRegistry](key, DefaultCipherSuite, c)
+}
+
 func (c OrganizationRegistry) GetTransformConfig() cryptostruct.TransformConfig {
 	return cryptostruct.TransformConfig{
 		Decrypted: OrganizationRegistry{},
@@ -41,6 +45,18 @@ func (c OrganizationRegistry) GetTransformConfig() cryptostruct.TransformConfig
 	}
 }
 
+func (c OrganizationRegistry) Validate() error {
+	return c.validate("").errorOrNil()
+}
+
+func (c OrganizationRegistry) validate(path string) ValidationErrors {
+	var errs ValidationErrors
+	errs = append(errs, c.Machines.validate(childPath(path, "machines"))...)
+	errs = append(errs, c.Certificates.validate(childPath(path, "certificates"))...)
+	errs = append(errs, c.Mail.validate(childPath(path, "mail"))...)
+	return errs
+}
+
 type SecureOrganizationRegistry struct {
 	Machines     SecureMachinesRegistry    `json:"machines,omitempty" yaml:"machines,omitempty" mapstructure:"machines,omitempty" secure:"true"`
 	Certificates SecureCertificateRegistry `json:"certificates,omitempty" yaml:"certificates,omitempty" mapstructure:"certificates,omitempty" secure:"true"`
@@ -48,6 +64,10 @@ type SecureOrganizationRegistry struct {
 	CryptoParams cryptostruct.CryptoParams `json:"cryptoParams" yaml:"cryptoParams" mapstructure:"cryptoParams"`
 }
 
+func (s SecureOrganizationRegistry) Decrypt(key string) (OrganizationRegistry, error) {
+	return decrypt[OrganizationRegistry](key, s)
+}
+
 func (s SecureOrganizationRegistry) GetCryptoParams() cryptostruct.CryptoParams {
 	return s.CryptoParams
 }
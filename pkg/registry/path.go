@@ -0,0 +1,459 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// A registry path addresses an item or field in a registry, starting with the organization name.
+// Segments are matched against item names in collections and against the json names of fields,
+// such as acme-corp/netscaler/adc/prod/credentials/nsroot or acme-corp/certificates/acme/users/admin/email.
+// The organization registry, the machines registry and the list of netscaler adc environments are skipped in paths.
+// Entries in labels and annotations are addressed by key, such as acme-corp/netscaler/adc/prod/labels/region.
+// Slashes and percent signs in names are escaped as %2F and %25.
+
+var pathEscaper = strings.NewReplacer("%", "%25", "/", "%2F")
+
+// inlinePathFields lists the fields which do not have a segment of their own in a path
+var inlinePathFields = map[reflect.Type]string{
+	reflect.TypeOf(Organization{}):               "Registry",
+	reflect.TypeOf(SecureOrganization{}):         "Registry",
+	reflect.TypeOf(OrganizationRegistry{}):       "Machines",
+	reflect.TypeOf(SecureOrganizationRegistry{}): "Machines",
+	reflect.TypeOf(NetScalerAdcRegistry{}):       "Environments",
+	reflect.TypeOf(SecureNetScalerAdcRegistry{}): "Environments",
+}
+
+// JoinPath escapes the segments and joins them into a registry path
+func JoinPath(segments ...string) string {
+	escaped := make([]string, len(segments))
+	for i, s := range segments {
+		escaped[i] = pathEscaper.Replace(s)
+	}
+	return strings.Join(escaped, "/")
+}
+
+// ParsePath splits a registry path into unescaped segments, an empty path addresses the list of organizations
+func ParsePath(path string) ([]string, error) {
+	var (
+		err     error
+		segment string
+	)
+
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return []string{}, nil
+	}
+
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if s == "" {
+			return nil, fmt.Errorf("invalid path %s: empty segment", path)
+		}
+		if segment, err = url.PathUnescape(s); err != nil {
+			return nil, fmt.Errorf("invalid path %s: %w", path, err)
+		}
+		segments[i] = segment
+	}
+	return segments, nil
+}
+
+// Delete removes the item at path, or resets the field at path to its zero value
+func (r Registry) Delete(path string) (Registry, error) {
+	err := deletePath(reflect.ValueOf(&r.Organizations).Elem(), path)
+	return r, err
+}
+
+// Get returns the organization, item or field value at path
+func (r Registry) Get(path string) (any, error) {
+	return getPath(reflect.ValueOf(&r.Organizations).Elem(), path)
+}
+
+// List returns the names of the children of path, which are item names for collections and field names otherwise
+func (r Registry) List(path string) ([]string, error) {
+	return listPath(reflect.ValueOf(&r.Organizations).Elem(), path)
+}
+
+// Set stores value at path.
+// An item which does not exist yet is added to its collection, the name of the item is set from the path if it is empty.
+// Strings are converted when setting a boolean or numeric field, documents decoded from json or yaml as a map are converted to items.
+func (r Registry) Set(path string, value any) (Registry, error) {
+	err := setPath(reflect.ValueOf(&r.Organizations).Elem(), path, value)
+	return r, err
+}
+
+// DeleteWithKeyring decrypts the registry with the keyring, deletes path and reseals the registry
+func (s SecureRegistry) DeleteWithKeyring(k Keyring, path string) (SecureRegistry, error) {
+	return s.modifyWithKeyring(k, path, func(r Registry) (Registry, error) {
+		return r.Delete(path)
+	})
+}
+
+// Get returns the encrypted organization, item or field value at path
+func (s SecureRegistry) Get(path string) (any, error) {
+	return getPath(reflect.ValueOf(&s.Organizations).Elem(), path)
+}
+
+func (s SecureRegistry) List(path string) ([]string, error) {
+	return listPath(reflect.ValueOf(&s.Organizations).Elem(), path)
+}
+
+// SetWithKeyring decrypts the registry with the keyring, sets value at path and reseals the registry
+func (s SecureRegistry) SetWithKeyring(k Keyring, path string, value any) (SecureRegistry, error) {
+	return s.modifyWithKeyring(k, path, func(r Registry) (Registry, error) {
+		return r.Set(path, value)
+	})
+}
+
+func (s SecureRegistry) modifyWithKeyring(k Keyring, path string, f func(r Registry) (Registry, error)) (SecureRegistry, error) {
+	var (
+		err      error
+		segments []string
+		r        Registry
+		sealed   []string
+	)
+
+	if segments, err = ParsePath(path); err != nil {
+		return SecureRegistry{}, err
+	}
+	if r, sealed, err = s.DecryptWithKeyring(k); err != nil {
+		return SecureRegistry{}, err
+	}
+	if len(segments) > 0 && slices.Contains(sealed, segments[0]) {
+		return SecureRegistry{}, fmt.Errorf("could not unlock organization %s: %w", segments[0], ErrInvalidKey)
+	}
+
+	if r, err = f(r); err != nil {
+		return SecureRegistry{}, err
+	}
+	return s.Reseal(r, k)
+}
+
+func deletePath(root reflect.Value, path string) error {
+	parent, segment, err := resolveParent(root, path)
+	if err != nil {
+		return err
+	}
+
+	if parent.Kind() == reflect.Map {
+		if !parent.MapIndex(reflect.ValueOf(segment)).IsValid() {
+			return NewItemNotFoundError("key", segment).WithParent(parentPath(path))
+		}
+		output := cloneMap(parent)
+		output.SetMapIndex(reflect.ValueOf(segment), reflect.Value{})
+		parent.Set(output)
+		return nil
+	}
+
+	child, collection, index := lookupSegment(parent, segment)
+	switch {
+	case collection.IsValid() && index >= 0:
+		output := reflect.MakeSlice(collection.Type(), 0, collection.Len()-1)
+		output = reflect.AppendSlice(output, collection.Slice(0, index))
+		collection.Set(reflect.AppendSlice(output, collection.Slice(index+1, collection.Len())))
+	case collection.IsValid() || !child.IsValid():
+		return NewItemNotFoundError("item", segment).WithParent(parentPath(path))
+	default:
+		child.Set(reflect.Zero(child.Type()))
+	}
+	return nil
+}
+
+func getPath(root reflect.Value, path string) (any, error) {
+	v, err := resolvePath(root, path, false)
+	if err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
+
+func listPath(root reflect.Value, path string) ([]string, error) {
+	v, err := resolvePath(root, path, false)
+	if err != nil {
+		return nil, err
+	}
+	if !hasChildren(v) {
+		return nil, fmt.Errorf("%s is a field and has no children", path)
+	}
+	return childNames(v), nil
+}
+
+func setPath(root reflect.Value, path string, value any) error {
+	parent, segment, err := resolveParent(root, path)
+	if err != nil {
+		return err
+	}
+
+	if parent.Kind() == reflect.Map {
+		entry := reflect.New(parent.Type().Elem()).Elem()
+		if err = assignValue(entry, value); err != nil {
+			return fmt.Errorf("could not set %s: %w", path, err)
+		}
+		output := cloneMap(parent)
+		output.SetMapIndex(reflect.ValueOf(segment), entry)
+		parent.Set(output)
+		return nil
+	}
+
+	child, collection, index := lookupSegment(parent, segment)
+	switch {
+	case collection.IsValid():
+		item := reflect.New(collection.Type().Elem()).Elem()
+		if err = assignValue(item, value); err != nil {
+			return fmt.Errorf("could not set %s: %w", path, err)
+		}
+		name := itemNameField(item)
+		if name.String() == "" {
+			name.SetString(segment)
+		}
+		if name.String() != segment {
+			return fmt.Errorf("could not set %s: item name %s does not match the path", path, name.String())
+		}
+		collection.Set(cloneSlice(collection))
+		if index < 0 {
+			collection.Set(reflect.Append(collection, item))
+		} else {
+			collection.Index(index).Set(item)
+		}
+	case child.IsValid():
+		if err = assignValue(child, value); err != nil {
+			return fmt.Errorf("could not set %s: %w", path, err)
+		}
+	default:
+		return NewItemNotFoundError("field", segment).WithParent(parentPath(path))
+	}
+	return nil
+}
+
+// resolveParent returns a writable copy of the parent of the last segment of path
+func resolveParent(root reflect.Value, path string) (reflect.Value, string, error) {
+	segments, err := ParsePath(path)
+	if err != nil {
+		return reflect.Value{}, "", err
+	}
+	if len(segments) == 0 {
+		return reflect.Value{}, "", fmt.Errorf("path must not be empty")
+	}
+
+	parent, err := resolvePath(root, JoinPath(segments[:len(segments)-1]...), true)
+	if err != nil {
+		return reflect.Value{}, "", err
+	}
+	if !hasChildren(parent) {
+		return reflect.Value{}, "", fmt.Errorf("%s is a field and has no children", parentPath(path))
+	}
+	return parent, segments[len(segments)-1], nil
+}
+
+// resolvePath returns the value at path.
+// When writable is set, every collection on the path is replaced with a copy, so the original registry is not modified.
+func resolvePath(root reflect.Value, path string, writable bool) (reflect.Value, error) {
+	segments, err := ParsePath(path)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	v := root
+	for i, segment := range segments {
+		if !hasChildren(v) {
+			return reflect.Value{}, fmt.Errorf("%s is a field and has no children", JoinPath(segments[:i]...))
+		}
+
+		child, collection, index := lookupSegment(v, segment)
+		if collection.IsValid() && index >= 0 && writable {
+			collection.Set(cloneSlice(collection))
+			child = collection.Index(index)
+		}
+		if !child.IsValid() {
+			return reflect.Value{}, NewItemNotFoundError("item", segment).WithParent(JoinPath(segments[:i]...))
+		}
+		v = child
+	}
+	return v, nil
+}
+
+// lookupSegment returns the child of v addressed by segment.
+// If segment addresses an item in a collection, the collection is returned with the index of the item, or -1 if the item does not exist.
+func lookupSegment(v reflect.Value, segment string) (reflect.Value, reflect.Value, int) {
+	if v.Kind() == reflect.Map {
+		return v.MapIndex(reflect.ValueOf(segment)), reflect.Value{}, -1
+	}
+	if v.Kind() == reflect.Slice {
+		for i := 0; i < v.Len(); i++ {
+			if itemNameField(v.Index(i)).String() == segment {
+				return v.Index(i), v, i
+			}
+		}
+		return reflect.Value{}, v, -1
+	}
+
+	inline := inlinePathFields[v.Type()]
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Name != inline && pathFieldName(field) == segment {
+			return v.Field(i), reflect.Value{}, -1
+		}
+	}
+	if inline != "" {
+		return lookupSegment(v.FieldByName(inline), segment)
+	}
+	return reflect.Value{}, reflect.Value{}, -1
+}
+
+func childNames(v reflect.Value) []string {
+	output := make([]string, 0)
+	if v.Kind() == reflect.Map {
+		for _, key := range v.MapKeys() {
+			output = append(output, key.String())
+		}
+		slices.Sort(output)
+		return output
+	}
+	if v.Kind() == reflect.Slice {
+		for i := 0; i < v.Len(); i++ {
+			output = append(output, itemNameField(v.Index(i)).String())
+		}
+		return output
+	}
+
+	inline := inlinePathFields[v.Type()]
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if name := pathFieldName(field); name != "" && field.Name != inline {
+			output = append(output, name)
+		}
+	}
+	if inline != "" {
+		output = append(output, childNames(v.FieldByName(inline))...)
+	}
+	return output
+}
+
+// pathFieldName returns the name of a field in a path, or an empty string if the field cannot be addressed
+func pathFieldName(field reflect.StructField) string {
+	if !field.IsExported() || field.Name == "CryptoParams" {
+		return ""
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// itemNameField returns the field which identifies an item in a collection
+func itemNameField(v reflect.Value) reflect.Value {
+	if name := v.FieldByName("Name"); name.IsValid() {
+		return name
+	}
+	return v.FieldByName("Key")
+}
+
+func assignValue(target reflect.Value, value any) error {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		target.Set(reflect.Zero(target.Type()))
+		return nil
+	}
+	if v.Type().AssignableTo(target.Type()) {
+		target.Set(v)
+		return nil
+	}
+
+	// Documents decoded from json or yaml are converted using the json names of the fields
+	if document, isDocument := value.(map[string]any); isDocument && target.Kind() == reflect.Struct {
+		data, err := json.Marshal(document)
+		if err != nil {
+			return err
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		target.Set(reflect.Zero(target.Type()))
+		if err = decoder.Decode(target.Addr().Interface()); err != nil {
+			return fmt.Errorf("cannot assign document to %s: %w", target.Type(), err)
+		}
+		return nil
+	}
+
+	s, isString := value.(string)
+	if !isString {
+		return fmt.Errorf("cannot assign %T to %s", value, target.Type())
+	}
+	switch target.Kind() {
+	case reflect.String:
+		target.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", s)
+		}
+		target.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, target.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		target.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, target.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		target.SetUint(u)
+	default:
+		return fmt.Errorf("cannot assign %T to %s", value, target.Type())
+	}
+	return nil
+}
+
+func cloneMap(v reflect.Value) reflect.Value {
+	output := reflect.MakeMapWithSize(v.Type(), v.Len())
+	for _, key := range v.MapKeys() {
+		output.SetMapIndex(key, v.MapIndex(key))
+	}
+	return output
+}
+
+func cloneSlice(v reflect.Value) reflect.Value {
+	output := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+	reflect.Copy(output, v)
+	return output
+}
+
+// hasChildren returns true for collections, maps and structs, which can be addressed by a further path segment
+func hasChildren(v reflect.Value) bool {
+	return v.Kind() == reflect.Slice || v.Kind() == reflect.Map || v.Kind() == reflect.Struct
+}
+
+func parentPath(path string) string {
+	segments, _ := ParsePath(path)
+	if len(segments) == 0 {
+		return ""
+	}
+	return JoinPath(segments[:len(segments)-1]...)
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"reflect"
+)
+
+const (
+	RedactedValue = "********"
+)
+
+// Redact returns a copy of v in which every non-empty string field tagged secure:"true" is replaced by RedactedValue.
+// Names, labels and other fields which are not encrypted in a SecureRegistry are kept.
+func Redact[T any](v T) T {
+	value := reflect.ValueOf(&v).Elem()
+	output, ok := redactValue(value, false).Interface().(T)
+	if !ok {
+		return v
+	}
+	return output
+}
+
+func redactValue(v reflect.Value, secure bool) reflect.Value {
+	switch v.Kind() {
+	case reflect.String:
+		if secure && v.String() != "" {
+			output := reflect.New(v.Type()).Elem()
+			output.SetString(RedactedValue)
+			return output
+		}
+	case reflect.Struct:
+		output := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			output.Field(i).Set(redactValue(v.Field(i), field.Tag.Get("secure") == "true"))
+		}
+		return output
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		output := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			output.Index(i).Set(redactValue(v.Index(i), secure))
+		}
+		return output
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		output := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for _, key := range v.MapKeys() {
+			output.SetMapIndex(key, redactValue(v.MapIndex(key), secure))
+		}
+		return output
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		output := reflect.New(v.Type()).Elem()
+		output.Set(redactValue(v.Elem(), secure))
+		return output
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		output := reflect.New(v.Type().Elem())
+		output.Elem().Set(redactValue(v.Elem(), secure))
+		return output
+	}
+	return v
+}
@@ -16,7 +16,11 @@
 
 package registry
 
-import "github.com/corelayer/go-cryptostruct/pkg/cryptostruct"
+import (
+	"fmt"
+
+	"github.com/corelayer/go-cryptostruct/pkg/cryptostruct"
+)
 
 func NewEmptyRegistry() Registry {
 	return Registry{
@@ -115,6 +119,20 @@ type Registry struct {
 	Organizations []Organization `json:"organizations,omitempty" yaml:"organizations,omitempty" mapstructure:"organizations,omitempty" secure:"true"`
 }
 
+func (r Registry) AddOrganization(organization Organization) (Registry, error) {
+	organizations, err := addItem(r.Organizations, organization, "organization", "")
+	if err != nil {
+		return r, err
+	}
+	r.Organizations = organizations
+	return r, nil
+}
+
+// Encrypt derives a new registry key from the passphrase and encrypts all organizations with it
+func (r Registry) Encrypt(passphrase string) (SecureRegistry, error) {
+	return r.EncryptWithKeyring(NewKeyring(passphrase))
+}
+
 func (r Registry) GetOrganizationByName(name string) (Organization, error) {
 	for _, o := range r.Organizations {
 		if o.Name == name {
@@ -140,9 +158,70 @@ func (o Registry) GetTransformConfig() cryptostruct.TransformConfig {
 	}
 }
 
+func (r Registry) RemoveOrganization(name string) (Registry, error) {
+	organizations, err := removeItem(r.Organizations, name, "organization", "")
+	if err != nil {
+		return r, err
+	}
+	r.Organizations = organizations
+	return r, nil
+}
+
+func (r Registry) UpdateOrganization(organization Organization) (Registry, error) {
+	organizations, err := updateItem(r.Organizations, organization, "organization", "")
+	if err != nil {
+		return r, err
+	}
+	r.Organizations = organizations
+	return r, nil
+}
+
+func (r Registry) UpsertOrganization(organization Organization) Registry {
+	r.Organizations = upsertItem(r.Organizations, organization)
+	return r
+}
+
+func (r Registry) Validate() error {
+	return r.validate("").errorOrNil()
+}
+
+func (r Registry) validate(path string) ValidationErrors {
+	errs := validateCollection(path, "organizations", "name", r.Organizations)
+	for i, o := range r.Organizations {
+		errs = append(errs, o.validate(itemPath(path, "organizations", o.Name, i))...)
+	}
+	return errs
+}
+
+// SecureRegistry is the encrypted form of a Registry.
+// Its header fields are not part of Registry, so decryption is handled per organization instead of through cryptostruct.
 type SecureRegistry struct {
-	Organizations []SecureOrganization      `json:"organizations,omitempty" yaml:"organizations,omitempty" mapstructure:"organizations,omitempty" secure:"true"`
-	CryptoParams  cryptostruct.CryptoParams `json:"cryptoParams" yaml:"cryptoParams" mapstructure:"cryptoParams"`
+	SchemaVersion    int                       `json:"schemaVersion,omitempty" yaml:"schemaVersion,omitempty" mapstructure:"schemaVersion,omitempty"`
+	Revision         uint64                    `json:"revision,omitempty" yaml:"revision,omitempty" mapstructure:"revision,omitempty"`
+	Organizations    []SecureOrganization      `json:"organizations,omitempty" yaml:"organizations,omitempty" mapstructure:"organizations,omitempty" secure:"true"`
+	OrganizationKeys []OrganizationKey         `json:"organizationKeys,omitempty" yaml:"organizationKeys,omitempty" mapstructure:"organizationKeys,omitempty"`
+	KeyDerivation    KeyDerivation             `json:"keyDerivation,omitempty" yaml:"keyDerivation,omitempty" mapstructure:"keyDerivation,omitempty"`
+	KeyCheck         string                    `json:"keyCheck,omitempty" yaml:"keyCheck,omitempty" mapstructure:"keyCheck,omitempty"`
+	Envelope         *Envelope                 `json:"envelope,omitempty" yaml:"envelope,omitempty" mapstructure:"envelope,omitempty"`
+	CryptoParams     cryptostruct.CryptoParams `json:"cryptoParams" yaml:"cryptoParams" mapstructure:"cryptoParams"`
+}
+
+// Decrypt decrypts all organizations with the passphrase.
+// Organizations with their own key are only decrypted if their key is the same passphrase.
+func (s SecureRegistry) Decrypt(passphrase string) (Registry, error) {
+	r, sealed, err := s.DecryptWithKeyring(NewKeyring(passphrase))
+	if err != nil {
+		return Registry{}, err
+	}
+	if len(sealed) > 0 {
+		return Registry{}, fmt.Errorf("could not decrypt organization %s: %w", sealed[0], ErrInvalidKey)
+	}
+	return r, nil
+}
+
+// DeriveKey returns the key to decrypt individual items of the registry, such as a single SecureOrganization
+func (s SecureRegistry) DeriveKey(passphrase string) (string, error) {
+	return s.KeyDerivation.DeriveKey(passphrase)
 }
 
 func (s SecureRegistry) GetCryptoParams() cryptostruct.CryptoParams {
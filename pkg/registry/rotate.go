@@ -0,0 +1,108 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+)
+
+// RotateKey re-encrypts every item in the registry with newKey, using fresh CryptoParams and key derivation parameters.
+// Organizations with their own key, other than oldKey, are kept as they are.
+// The rotated registry is verified to decrypt to the same contents under newKey before it is returned.
+func RotateKey(s SecureRegistry, oldKey string, newKey string) (SecureRegistry, error) {
+	rotated, _, err := rotateKey(s, oldKey, newKey)
+	return rotated, err
+}
+
+// RotateKey rotates the key of the registry file, replacing the file only after the rotated contents have been verified
+func (l Loader) RotateKey(oldKey string, newKey string) error {
+	return l.withLock(func() error {
+		return l.rotateFileKey(oldKey, newKey)
+	})
+}
+
+func (l Loader) rotateFileKey(oldKey string, newKey string) error {
+	var (
+		err     error
+		s       SecureRegistry
+		rotated SecureRegistry
+		r       Registry
+		data    []byte
+		perm    os.FileMode
+	)
+
+	if s, err = l.LoadSecure(); err != nil {
+		return err
+	}
+	if rotated, r, err = rotateKey(s, oldKey, newKey); err != nil {
+		return fmt.Errorf("could not rotate key for registry file %s: %w", l.Path, err)
+	}
+	rotated.Revision = s.Revision + 1
+	if data, perm, err = l.serialize(rotated); err != nil {
+		return err
+	}
+
+	// Verify the serialized registry as it will be written to disk
+	var written SecureRegistry
+	if err = unmarshal(data, &written, DetectFormat(l.Path, data)); err != nil {
+		return fmt.Errorf("could not verify rotated registry for file %s: %w", l.Path, err)
+	}
+	if err = verifyRotation(written, newKey, r); err != nil {
+		return fmt.Errorf("could not verify rotated registry for file %s: %w", l.Path, err)
+	}
+
+	return writeFileAtomic(l.Path, data, perm)
+}
+
+func rotateKey(s SecureRegistry, oldKey string, newKey string) (SecureRegistry, Registry, error) {
+	var (
+		err     error
+		r       Registry
+		rotated SecureRegistry
+	)
+
+	// Organizations with their own key, other than the old key, remain sealed and keep their key
+	if r, _, err = s.DecryptWithKeyring(NewKeyring(oldKey)); err != nil {
+		return SecureRegistry{}, Registry{}, fmt.Errorf("could not decrypt registry with old key: %w", err)
+	}
+	cipherSuite := s.CryptoParams.CipherSuite
+	if cipherSuite == "" {
+		cipherSuite = DefaultCipherSuite
+	}
+	// The new key does not unlock s, so the organizations decrypted with the old key are replaced on purpose
+	if rotated, err = s.reseal(r, NewKeyring(newKey), cipherSuite, false); err != nil {
+		return SecureRegistry{}, Registry{}, fmt.Errorf("could not encrypt registry with new key: %w", err)
+	}
+
+	if err = verifyRotation(rotated, newKey, r); err != nil {
+		return SecureRegistry{}, Registry{}, err
+	}
+	return rotated, r, nil
+}
+
+func verifyRotation(rotated SecureRegistry, newKey string, expected Registry) error {
+	decrypted, _, err := rotated.DecryptWithKeyring(NewKeyring(newKey))
+	if err != nil {
+		return fmt.Errorf("rotated registry does not decrypt with new key: %w", err)
+	}
+	if !reflect.DeepEqual(decrypted, expected) {
+		return fmt.Errorf("rotated registry does not match the original registry")
+	}
+	return nil
+}
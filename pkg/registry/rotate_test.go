@@ -0,0 +1,154 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestRotateKey(t *testing.T) {
+	l, k := newTestLoader(t)
+	if err := l.SaveWithKeyring(k, Registry{Organizations: []Organization{newTestOrganization("a", "secret")}}); err != nil {
+		t.Fatalf("SaveWithKeyring returned error: %v", err)
+	}
+	s, err := l.LoadSecure()
+	if err != nil {
+		t.Fatalf("LoadSecure returned error: %v", err)
+	}
+	expected, _, err := s.DecryptWithKeyring(k)
+	if err != nil {
+		t.Fatalf("DecryptWithKeyring returned error: %v", err)
+	}
+
+	rotated, err := RotateKey(s, "test key", "new key")
+	if err != nil {
+		t.Fatalf("RotateKey returned error: %v", err)
+	}
+	if _, _, err = rotated.DecryptWithKeyring(k); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("rotated registry decrypted with the old key: %v", err)
+	}
+	r, _, err := rotated.DecryptWithKeyring(NewKeyring("new key"))
+	if err != nil {
+		t.Fatalf("rotated registry does not decrypt with the new key: %v", err)
+	}
+	if !reflect.DeepEqual(r, expected) {
+		t.Errorf("rotated registry decrypted to %+v, want %+v", r, expected)
+	}
+
+	before := testCredential(s, 0)
+	after := testCredential(rotated, 0)
+	if before.Password == after.Password || reflect.DeepEqual(before.CryptoParams, after.CryptoParams) {
+		t.Errorf("rotated registry kept the ciphertext or crypto parameters of a credential")
+	}
+	if reflect.DeepEqual(s.KeyDerivation, rotated.KeyDerivation) {
+		t.Errorf("rotated registry kept the key derivation parameters")
+	}
+}
+
+func TestRotateKeyVerifiesResult(t *testing.T) {
+	l, k := newTestLoader(t)
+	if err := l.SaveWithKeyring(k, Registry{Organizations: []Organization{newTestOrganization("a", "secret")}}); err != nil {
+		t.Fatalf("SaveWithKeyring returned error: %v", err)
+	}
+	s, err := l.LoadSecure()
+	if err != nil {
+		t.Fatalf("LoadSecure returned error: %v", err)
+	}
+	expected, _, err := s.DecryptWithKeyring(k)
+	if err != nil {
+		t.Fatalf("DecryptWithKeyring returned error: %v", err)
+	}
+	rotated, err := RotateKey(s, "test key", "new key")
+	if err != nil {
+		t.Fatalf("RotateKey returned error: %v", err)
+	}
+
+	if err = verifyRotation(rotated, "new key", expected); err != nil {
+		t.Errorf("verifyRotation of a rotated registry returned error: %v", err)
+	}
+	if err = verifyRotation(rotated, "wrong key", expected); err == nil {
+		t.Errorf("verifyRotation with a key which cannot decrypt the result returned no error")
+	}
+
+	// A registry which was encrypted with another key than the new key must be rejected
+	other, err := RotateKey(s, "test key", "other key")
+	if err != nil {
+		t.Fatalf("RotateKey returned error: %v", err)
+	}
+	if err = verifyRotation(other, "new key", expected); err == nil {
+		t.Errorf("verifyRotation of a registry encrypted with another key returned no error")
+	}
+
+	changed := cloneValue(reflect.ValueOf(expected)).Interface().(Registry)
+	changed.Organizations[0].Registry.Machines.NetScaler.Adc.Environments[0].Credentials[0].Password = "changed"
+	if err = verifyRotation(rotated, "new key", changed); err == nil {
+		t.Errorf("verifyRotation of a registry with different contents returned no error")
+	}
+}
+
+func TestLoaderRotateKeyWrongOldKey(t *testing.T) {
+	l, k := newTestLoader(t)
+	if err := l.SaveWithKeyring(k, Registry{Organizations: []Organization{newTestOrganization("a", "secret")}}); err != nil {
+		t.Fatalf("SaveWithKeyring returned error: %v", err)
+	}
+	data, err := os.ReadFile(l.Path)
+	if err != nil {
+		t.Fatalf("could not read registry file: %v", err)
+	}
+
+	if err = l.RotateKey("wrong key", "new key"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("RotateKey with a wrong old key returned %v, want %v", err, ErrInvalidKey)
+	}
+	written, err := os.ReadFile(l.Path)
+	if err != nil {
+		t.Fatalf("could not read registry file: %v", err)
+	}
+	if !bytes.Equal(written, data) {
+		t.Errorf("RotateKey with a wrong old key changed the registry file")
+	}
+
+	if err = l.RotateKey("test key", "new key"); err != nil {
+		t.Fatalf("RotateKey returned error: %v", err)
+	}
+	if _, err = l.Load("new key"); err != nil {
+		t.Errorf("registry file does not load with the new key: %v", err)
+	}
+	if _, err = l.Load("test key"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("registry file loaded with the old key after rotating: %v", err)
+	}
+}
+
+// newTestOrganization returns an organization holding a credential, so it has ciphertext which only decrypts with the right key
+func newTestOrganization(name string, password string) Organization {
+	o := NewOrganization(name)
+	o.Registry.Machines.NetScaler.Adc.Environments = []NetScalerAdcEnvironment{
+		{
+			Name:        "prod",
+			Credentials: []NetScalerAdcCredential{{Name: "nsroot", Username: "nsroot", Password: password}},
+		},
+	}
+	return o
+}
+
+// testCredential returns the encrypted credential of the organization at index i, as created by newTestOrganization
+func testCredential(s SecureRegistry, i int) SecureNetScalerAdcCredential {
+	return s.Organizations[i].Registry.Machines.NetScaler.Adc.Environments[0].Credentials[0]
+}
@@ -0,0 +1,239 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+type SelectorOperator string
+
+const (
+	SelectorOperatorEquals       SelectorOperator = "="
+	SelectorOperatorNotEquals    SelectorOperator = "!="
+	SelectorOperatorIn           SelectorOperator = "in"
+	SelectorOperatorNotIn        SelectorOperator = "notin"
+	SelectorOperatorExists       SelectorOperator = "exists"
+	SelectorOperatorDoesNotExist SelectorOperator = "!"
+)
+
+var setRequirementExpression = regexp.MustCompile(`^(\S+)\s+(in|notin)\s*\((.*)\)$`)
+
+// ParseSelector parses a label selector in the Kubernetes syntax, such as "env in (prod,acc),region=eu,!deprecated".
+// All requirements must match, an empty selector matches everything.
+func ParseSelector(selector string) (Selector, error) {
+	var (
+		err         error
+		requirement SelectorRequirement
+	)
+
+	output := Selector{}
+	for _, r := range splitSelector(selector) {
+		if r = strings.TrimSpace(r); r == "" {
+			if strings.TrimSpace(selector) == "" {
+				continue
+			}
+			return Selector{}, fmt.Errorf("invalid selector %q: empty requirement", selector)
+		}
+		if requirement, err = parseSelectorRequirement(r); err != nil {
+			return Selector{}, fmt.Errorf("invalid selector %q: %w", selector, err)
+		}
+		output.Requirements = append(output.Requirements, requirement)
+	}
+	return output, nil
+}
+
+type Selector struct {
+	Requirements []SelectorRequirement
+}
+
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s.Requirements {
+		if !r.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s Selector) String() string {
+	requirements := make([]string, len(s.Requirements))
+	for i, r := range s.Requirements {
+		requirements[i] = r.String()
+	}
+	return strings.Join(requirements, ",")
+}
+
+type SelectorRequirement struct {
+	Key      string
+	Operator SelectorOperator
+	Values   []string
+}
+
+// Matches follows the Kubernetes semantics, so != and notin also match labels which do not have the key
+func (r SelectorRequirement) Matches(labels map[string]string) bool {
+	value, found := labels[r.Key]
+	switch r.Operator {
+	case SelectorOperatorEquals, SelectorOperatorIn:
+		return found && slices.Contains(r.Values, value)
+	case SelectorOperatorNotEquals, SelectorOperatorNotIn:
+		return !found || !slices.Contains(r.Values, value)
+	case SelectorOperatorExists:
+		return found
+	case SelectorOperatorDoesNotExist:
+		return !found
+	default:
+		return false
+	}
+}
+
+func (r SelectorRequirement) String() string {
+	switch r.Operator {
+	case SelectorOperatorIn, SelectorOperatorNotIn:
+		return fmt.Sprintf("%s %s (%s)", r.Key, r.Operator, strings.Join(r.Values, ","))
+	case SelectorOperatorExists:
+		return r.Key
+	case SelectorOperatorDoesNotExist:
+		return "!" + r.Key
+	default:
+		return r.Key + string(r.Operator) + strings.Join(r.Values, ",")
+	}
+}
+
+// Selection is an item matched by a selector, with the organization and path of the item in the registry
+type Selection[T any] struct {
+	Organization string
+	Path         string
+	Item         T
+}
+
+// SelectEnvironments returns the netscaler adc environments of all organizations whose labels match the selector
+func (r Registry) SelectEnvironments(selector Selector) []Selection[NetScalerAdcEnvironment] {
+	output := make([]Selection[NetScalerAdcEnvironment], 0)
+	for _, o := range r.Organizations {
+		for _, e := range o.Registry.Machines.NetScaler.Adc.Environments {
+			if selector.Matches(e.Labels) {
+				output = append(output, Selection[NetScalerAdcEnvironment]{
+					Organization: o.Name,
+					Path:         JoinPath(o.Name, "netscaler", "adc", e.Name),
+					Item:         e,
+				})
+			}
+		}
+	}
+	return output
+}
+
+// SelectOrganizations returns the organizations whose labels match the selector
+func (r Registry) SelectOrganizations(selector Selector) []Organization {
+	output := make([]Organization, 0)
+	for _, o := range r.Organizations {
+		if selector.Matches(o.Labels) {
+			output = append(output, o)
+		}
+	}
+	return output
+}
+
+// SelectEnvironments returns the encrypted netscaler adc environments of all organizations whose labels match the selector.
+// Labels are not encrypted, so no key is needed.
+func (s SecureRegistry) SelectEnvironments(selector Selector) []Selection[SecureNetScalerAdcEnvironment] {
+	output := make([]Selection[SecureNetScalerAdcEnvironment], 0)
+	for _, o := range s.Organizations {
+		for _, e := range o.Registry.Machines.NetScaler.Adc.Environments {
+			if selector.Matches(e.Labels) {
+				output = append(output, Selection[SecureNetScalerAdcEnvironment]{
+					Organization: o.Name,
+					Path:         JoinPath(o.Name, "netscaler", "adc", e.Name),
+					Item:         e,
+				})
+			}
+		}
+	}
+	return output
+}
+
+func (s SecureRegistry) SelectOrganizations(selector Selector) []SecureOrganization {
+	output := make([]SecureOrganization, 0)
+	for _, o := range s.Organizations {
+		if selector.Matches(o.Labels) {
+			output = append(output, o)
+		}
+	}
+	return output
+}
+
+func parseSelectorRequirement(r string) (SelectorRequirement, error) {
+	var output SelectorRequirement
+
+	switch {
+	case setRequirementExpression.MatchString(r):
+		matches := setRequirementExpression.FindStringSubmatch(r)
+		output = SelectorRequirement{Key: matches[1], Operator: SelectorOperator(matches[2])}
+		for _, v := range strings.Split(matches[3], ",") {
+			output.Values = append(output.Values, strings.TrimSpace(v))
+		}
+	case strings.HasPrefix(r, "!") && !strings.Contains(r, "="):
+		output = SelectorRequirement{Key: strings.TrimSpace(r[1:]), Operator: SelectorOperatorDoesNotExist}
+	case strings.Contains(r, "!="):
+		key, value, _ := strings.Cut(r, "!=")
+		output = SelectorRequirement{Key: strings.TrimSpace(key), Operator: SelectorOperatorNotEquals, Values: []string{strings.TrimSpace(value)}}
+	case strings.Contains(r, "="):
+		key, value, _ := strings.Cut(r, "=")
+		value = strings.TrimPrefix(value, "=")
+		output = SelectorRequirement{Key: strings.TrimSpace(key), Operator: SelectorOperatorEquals, Values: []string{strings.TrimSpace(value)}}
+	default:
+		output = SelectorRequirement{Key: r, Operator: SelectorOperatorExists}
+	}
+
+	if !isValidLabelKey(output.Key) {
+		return SelectorRequirement{}, fmt.Errorf("invalid label key %q", output.Key)
+	}
+	for _, v := range output.Values {
+		if !isValidLabelName(v, true) {
+			return SelectorRequirement{}, fmt.Errorf("invalid label value %q for key %s", v, output.Key)
+		}
+	}
+	return output, nil
+}
+
+// splitSelector splits a selector on the commas which are not part of a set of values
+func splitSelector(selector string) []string {
+	var (
+		output []string
+		depth  int
+		start  int
+	)
+
+	for i, c := range selector {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				output = append(output, selector[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(output, selector[start:])
+}
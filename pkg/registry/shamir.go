@@ -0,0 +1,210 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	shamirMaxShares = 255
+)
+
+// SplitKey splits a registry key into shares using Shamir's secret sharing over GF(256).
+// Any threshold shares can reconstruct the key with CombineShares, fewer shares reveal nothing about the key.
+// Each share is a hex encoded string holding the threshold, the x coordinate and the y coordinates of the share.
+func SplitKey(key string, shares int, threshold int) ([]string, error) {
+	if key == "" {
+		return nil, fmt.Errorf("cannot split an empty key")
+	}
+	if threshold < 2 {
+		return nil, fmt.Errorf("threshold must be at least 2")
+	}
+	if shares < threshold {
+		return nil, fmt.Errorf("number of shares must be at least the threshold %d", threshold)
+	}
+	if shares > shamirMaxShares {
+		return nil, fmt.Errorf("number of shares must be at most %d", shamirMaxShares)
+	}
+
+	secret := []byte(key)
+	points := make([][]byte, shares)
+	for i := range points {
+		points[i] = make([]byte, len(secret)+2)
+		points[i][0] = byte(threshold)
+		points[i][1] = byte(i + 1)
+	}
+
+	// Use a random polynomial of degree threshold-1 for every byte of the key, with the key byte as the constant term
+	coefficients := make([]byte, threshold)
+	for b, s := range secret {
+		coefficients[0] = s
+		if _, err := io.ReadFull(rand.Reader, coefficients[1:]); err != nil {
+			return nil, fmt.Errorf("failed to read random data for shares: %w", err)
+		}
+		for i := range points {
+			points[i][b+2] = gfEvaluate(coefficients, points[i][1])
+		}
+	}
+
+	output := make([]string, shares)
+	for i, p := range points {
+		output[i] = hex.EncodeToString(p)
+	}
+	return output, nil
+}
+
+// CombineShares reconstructs a registry key from at least the threshold number of shares created by SplitKey
+func CombineShares(shares []string) (string, error) {
+	var (
+		err     error
+		decoded []byte
+	)
+
+	if len(shares) == 0 {
+		return "", fmt.Errorf("no shares to combine")
+	}
+
+	points := make([][]byte, 0, len(shares))
+	seen := make(map[byte][]byte, len(shares))
+	for _, s := range shares {
+		if decoded, err = hex.DecodeString(strings.TrimSpace(s)); err != nil || len(decoded) < 3 {
+			return "", fmt.Errorf("invalid share")
+		}
+		if len(points) > 0 && (len(decoded) != len(points[0]) || decoded[0] != points[0][0]) {
+			return "", fmt.Errorf("shares do not belong to the same key")
+		}
+		if decoded[0] < 2 || decoded[1] == 0 {
+			return "", fmt.Errorf("invalid share")
+		}
+		if previous, found := seen[decoded[1]]; found {
+			if !bytes.Equal(previous, decoded) {
+				return "", fmt.Errorf("conflicting shares for x coordinate %d", decoded[1])
+			}
+			continue
+		}
+		seen[decoded[1]] = decoded
+		points = append(points, decoded)
+	}
+
+	threshold := int(points[0][0])
+	if len(points) < threshold {
+		return "", fmt.Errorf("need %d shares to combine the key, got %d", threshold, len(points))
+	}
+	points = points[:threshold]
+
+	// Lagrange interpolation at x = 0 for every byte of the key
+	secret := make([]byte, len(points[0])-2)
+	for b := range secret {
+		var value byte
+		for i, pi := range points {
+			basis := byte(1)
+			for j, pj := range points {
+				if i == j {
+					continue
+				}
+				// basis *= xj / (xj - xi), subtraction is xor in GF(256)
+				basis = gfMultiply(basis, gfDivide(pj[1], pj[1]^pi[1]))
+			}
+			value ^= gfMultiply(pi[b+2], basis)
+		}
+		secret[b] = value
+	}
+	return string(secret), nil
+}
+
+func NewShamirKeyProvider(providers ...KeyProvider) ShamirKeyProvider {
+	return ShamirKeyProvider{
+		Providers: providers,
+	}
+}
+
+// ShamirKeyProvider combines the shares returned by its providers into the registry key.
+// Providers which fail are skipped, as long as enough shares are available.
+type ShamirKeyProvider struct {
+	Providers []KeyProvider
+}
+
+func (p ShamirKeyProvider) GetKey() (string, error) {
+	var errs []error
+
+	shares := make([]string, 0, len(p.Providers))
+	for _, provider := range p.Providers {
+		share, err := provider.GetKey()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		shares = append(shares, share)
+	}
+
+	key, err := CombineShares(shares)
+	if err != nil {
+		return "", fmt.Errorf("could not combine key shares: %w: %w", errors.Join(append(errs, err)...), ErrKeyNotAvailable)
+	}
+	return key, nil
+}
+
+// GF(256) arithmetic with the AES reduction polynomial x^8 + x^4 + x^3 + x + 1, using 3 as generator
+var gfExp, gfLog = func() ([510]byte, [256]byte) {
+	var (
+		exp [510]byte
+		log [256]byte
+	)
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		exp[i] = x
+		exp[i+255] = x
+		log[x] = byte(i)
+		// Multiply x by the generator: x*3 = x*2 xor x
+		double := x << 1
+		if x&0x80 != 0 {
+			double ^= 0x1b
+		}
+		x = double ^ x
+	}
+	return exp, log
+}()
+
+func gfMultiply(a byte, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDivide(a byte, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// gfEvaluate evaluates the polynomial with the given coefficients at x, using Horner's method
+func gfEvaluate(coefficients []byte, x byte) byte {
+	var result byte
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		result = gfMultiply(result, x) ^ coefficients[i]
+	}
+	return result
+}
@@ -0,0 +1,211 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+const testShamirKey = "correct horse battery staple"
+
+func TestSplitKeyCombineShares(t *testing.T) {
+	tests := []struct {
+		shares    int
+		threshold int
+	}{
+		{shares: 2, threshold: 2},
+		{shares: 3, threshold: 2},
+		{shares: 5, threshold: 3},
+		{shares: 10, threshold: 7},
+		{shares: shamirMaxShares, threshold: shamirMaxShares},
+	}
+
+	for _, tt := range tests {
+		shares, err := SplitKey(testShamirKey, tt.shares, tt.threshold)
+		if err != nil {
+			t.Fatalf("SplitKey(%d, %d) returned error: %v", tt.shares, tt.threshold, err)
+		}
+		if len(shares) != tt.shares {
+			t.Fatalf("SplitKey(%d, %d) returned %d shares", tt.shares, tt.threshold, len(shares))
+		}
+
+		key, err := CombineShares(shares)
+		if err != nil {
+			t.Fatalf("CombineShares with all %d shares returned error: %v", tt.shares, err)
+		}
+		if key != testShamirKey {
+			t.Errorf("CombineShares with all %d shares returned %q, want %q", tt.shares, key, testShamirKey)
+		}
+	}
+}
+
+func TestCombineSharesSubsets(t *testing.T) {
+	shares, err := SplitKey(testShamirKey, 5, 3)
+	if err != nil {
+		t.Fatalf("SplitKey returned error: %v", err)
+	}
+
+	// Every combination of 3 out of 5 shares, in both orders, must reconstruct the key
+	for i := 0; i < len(shares); i++ {
+		for j := i + 1; j < len(shares); j++ {
+			for k := j + 1; k < len(shares); k++ {
+				for _, subset := range [][]string{
+					{shares[i], shares[j], shares[k]},
+					{shares[k], shares[j], shares[i]},
+				} {
+					key, err := CombineShares(subset)
+					if err != nil {
+						t.Fatalf("CombineShares(%d, %d, %d) returned error: %v", i, j, k, err)
+					}
+					if key != testShamirKey {
+						t.Errorf("CombineShares(%d, %d, %d) returned %q, want %q", i, j, k, key, testShamirKey)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestCombineSharesTooFew(t *testing.T) {
+	shares, err := SplitKey(testShamirKey, 5, 3)
+	if err != nil {
+		t.Fatalf("SplitKey returned error: %v", err)
+	}
+
+	for _, subset := range [][]string{
+		nil,
+		shares[:1],
+		shares[:2],
+		{shares[0], shares[0], shares[0]},
+		{shares[1], shares[2], shares[1]},
+	} {
+		if key, err := CombineShares(subset); err == nil {
+			t.Errorf("CombineShares with %d shares returned %q, want error", len(subset), key)
+		}
+	}
+}
+
+func TestCombineSharesDuplicates(t *testing.T) {
+	shares, err := SplitKey(testShamirKey, 3, 2)
+	if err != nil {
+		t.Fatalf("SplitKey returned error: %v", err)
+	}
+
+	key, err := CombineShares([]string{shares[0], shares[0], shares[1]})
+	if err != nil {
+		t.Fatalf("CombineShares with a repeated share returned error: %v", err)
+	}
+	if key != testShamirKey {
+		t.Errorf("CombineShares with a repeated share returned %q, want %q", key, testShamirKey)
+	}
+
+	// A share with the same x coordinate but different values must not be silently dropped
+	conflicting := []byte(mustDecodeShare(t, shares[0]))
+	conflicting[2] ^= 0xff
+	if key, err = CombineShares([]string{shares[0], hex.EncodeToString(conflicting), shares[1]}); err == nil {
+		t.Errorf("CombineShares with conflicting shares returned %q, want error", key)
+	}
+}
+
+func TestCombineSharesMalformed(t *testing.T) {
+	shares, err := SplitKey(testShamirKey, 3, 2)
+	if err != nil {
+		t.Fatalf("SplitKey returned error: %v", err)
+	}
+	share := mustDecodeShare(t, shares[0])
+
+	withByte := func(i int, b byte) string {
+		modified := []byte(share)
+		modified[i] = b
+		return hex.EncodeToString(modified)
+	}
+
+	tests := map[string]string{
+		"not hex":         "not a share",
+		"odd length":      shares[0][:len(shares[0])-1],
+		"too short":       shares[0][:4],
+		"empty":           "",
+		"zero x":          withByte(1, 0),
+		"zero threshold":  withByte(0, 0),
+		"threshold one":   withByte(0, 1),
+		"other threshold": withByte(0, 3),
+		"truncated":       shares[0][:len(shares[0])-2],
+	}
+	for name, malformed := range tests {
+		if key, err := CombineShares([]string{malformed, shares[1], shares[2]}); err == nil {
+			t.Errorf("CombineShares with %s share returned %q, want error", name, key)
+		}
+	}
+
+	// A lone share which claims a threshold of 1 must not yield its y coordinates as the key
+	if key, err := CombineShares([]string{withByte(0, 1)}); err == nil {
+		t.Errorf("CombineShares with a threshold of 1 returned %q, want error", key)
+	}
+}
+
+func TestCombineSharesMixedSets(t *testing.T) {
+	first, err := SplitKey(testShamirKey, 3, 2)
+	if err != nil {
+		t.Fatalf("SplitKey returned error: %v", err)
+	}
+	second, err := SplitKey(testShamirKey, 3, 3)
+	if err != nil {
+		t.Fatalf("SplitKey returned error: %v", err)
+	}
+	other, err := SplitKey("another key of a different length", 3, 2)
+	if err != nil {
+		t.Fatalf("SplitKey returned error: %v", err)
+	}
+
+	for name, subset := range map[string][]string{
+		"different thresholds": {first[0], second[1], second[2]},
+		"different lengths":    {first[0], other[1]},
+	} {
+		if key, err := CombineShares(subset); err == nil {
+			t.Errorf("CombineShares with %s returned %q, want error", name, key)
+		}
+	}
+}
+
+func TestSplitKeyInvalid(t *testing.T) {
+	tests := map[string]struct {
+		key       string
+		shares    int
+		threshold int
+	}{
+		"empty key":          {key: "", shares: 3, threshold: 2},
+		"threshold one":      {key: testShamirKey, shares: 3, threshold: 1},
+		"too few shares":     {key: testShamirKey, shares: 2, threshold: 3},
+		"too many shares":    {key: testShamirKey, shares: shamirMaxShares + 1, threshold: 2},
+		"negative threshold": {key: testShamirKey, shares: 3, threshold: -1},
+	}
+	for name, tt := range tests {
+		if _, err := SplitKey(tt.key, tt.shares, tt.threshold); err == nil {
+			t.Errorf("SplitKey with %s returned no error", name)
+		}
+	}
+}
+
+func mustDecodeShare(t *testing.T, share string) string {
+	t.Helper()
+	decoded, err := hex.DecodeString(share)
+	if err != nil {
+		t.Fatalf("could not decode share: %v", err)
+	}
+	return string(decoded)
+}
@@ -24,6 +24,10 @@ type SmtpAuthentication struct {
 	AuthenticationType string `json:"type,omitempty" yaml:"type,omitempty" mapstructure:"type,omitempty" secure:"true"`
 }
 
+func (s SmtpAuthentication) Encrypt(key string) (SecureSmtpAuthentication, error) {
+	return encrypt[SecureSmtpAuthentication](key, DefaultCipherSuite, s)
+}
+
 func (s SmtpAuthentication) GetTransformConfig() cryptostruct.TransformConfig {
 	return cryptostruct.TransformConfig{
 		Decrypted: SmtpAuthentication{},
@@ -31,6 +35,18 @@ func (s SmtpAuthentication) GetTransformConfig() cryptostruct.TransformConfig {
 	}
 }
 
+func (s SmtpAuthentication) Validate() error {
+	return s.validate("").errorOrNil()
+}
+
+func (s SmtpAuthentication) validate(path string) ValidationErrors {
+	var errs ValidationErrors
+	if s.Username == "" && s.Password != "" {
+		errs.add(fieldPath(path, "username"), "username is required when password is set")
+	}
+	return errs
+}
+
 type SecureSmtpAuthentication struct {
 	Username           string                    `json:"username,omitempty" yaml:"username,omitempty" mapstructure:"username,omitempty" secure:"true"`
 	Password           string                    `json:"password,omitempty" yaml:"password,omitempty" mapstructure:"password,omitempty" secure:"true"`
@@ -38,6 +54,10 @@ type SecureSmtpAuthentication struct {
 	CryptoParams       cryptostruct.CryptoParams `json:"cryptoParams" yaml:"cryptoParams" mapstructure:"cryptoParams"`
 }
 
+func (s SecureSmtpAuthentication) Decrypt(key string) (SmtpAuthentication, error) {
+	return decrypt[SmtpAuthentication](key, s)
+}
+
 func (s SecureSmtpAuthentication) GetCryptoParams() cryptostruct.CryptoParams {
 	return s.CryptoParams
 }
@@ -16,15 +16,25 @@
 
 package registry
 
-import "github.com/corelayer/go-cryptostruct/pkg/cryptostruct"
+import (
+	"strconv"
+
+	"github.com/corelayer/go-cryptostruct/pkg/cryptostruct"
+)
 
 type SmtpServer struct {
 	Name           string             `json:"name,omitempty" yaml:"name,omitempty" mapstructure:"name,omitempty" secure:"false"`
+	Labels         map[string]string  `json:"labels,omitempty" yaml:"labels,omitempty" mapstructure:"labels,omitempty" secure:"false"`
+	Annotations    map[string]string  `json:"annotations,omitempty" yaml:"annotations,omitempty" mapstructure:"annotations,omitempty" secure:"false"`
 	Address        string             `json:"address,omitempty" yaml:"address,omitempty" mapstructure:"address,omitempty" secure:"true"`
 	Port           string             `json:"port,omitempty" yaml:"port,omitempty" mapstructure:"port,omitempty" secure:"true"`
 	Authentication SmtpAuthentication `json:"authentication,omitempty" yaml:"authentication,omitempty" mapstructure:"authentication,omitempty" secure:"true"`
 }
 
+func (s SmtpServer) Encrypt(key string) (SecureSmtpServer, error) {
+	return encrypt[SecureSmtpServer](key, DefaultCipherSuite, s)
+}
+
 func (s SmtpServer) GetTransformConfig() cryptostruct.TransformConfig {
 	return cryptostruct.TransformConfig{
 		Decrypted: SmtpServer{},
@@ -32,14 +42,43 @@ func (s SmtpServer) GetTransformConfig() cryptostruct.TransformConfig {
 	}
 }
 
+func (s SmtpServer) Validate() error {
+	return s.validate("").errorOrNil()
+}
+
+func (s SmtpServer) itemName() string {
+	return s.Name
+}
+
+func (s SmtpServer) validate(path string) ValidationErrors {
+	errs := validateLabels(path, s.Labels, s.Annotations)
+	if s.Address == "" {
+		errs.add(fieldPath(path, "address"), "address is required")
+	} else if !isValidHost(s.Address) {
+		errs.add(fieldPath(path, "address"), "address is not a valid ip address or hostname")
+	}
+	if s.Port != "" {
+		if port, err := strconv.Atoi(s.Port); err != nil || port < 1 || port > 65535 {
+			errs.add(fieldPath(path, "port"), "port is not a valid port number")
+		}
+	}
+	return append(errs, s.Authentication.validate(childPath(path, "authentication"))...)
+}
+
 type SecureSmtpServer struct {
 	Name           string                    `json:"name,omitempty" yaml:"name,omitempty" mapstructure:"name,omitempty" secure:"false"`
+	Labels         map[string]string         `json:"labels,omitempty" yaml:"labels,omitempty" mapstructure:"labels,omitempty" secure:"false"`
+	Annotations    map[string]string         `json:"annotations,omitempty" yaml:"annotations,omitempty" mapstructure:"annotations,omitempty" secure:"false"`
 	Address        string                    `json:"address,omitempty" yaml:"address,omitempty" mapstructure:"address,omitempty" secure:"true"`
 	Port           string                    `json:"port,omitempty" yaml:"port,omitempty" mapstructure:"port,omitempty" secure:"true"`
 	Authentication SecureSmtpAuthentication  `json:"authentication,omitempty" yaml:"authentication,omitempty" mapstructure:"authentication,omitempty" secure:"true"`
 	CryptoParams   cryptostruct.CryptoParams `json:"cryptoParams" yaml:"cryptoParams" mapstructure:"cryptoParams"`
 }
 
+func (s SecureSmtpServer) Decrypt(key string) (SmtpServer, error) {
+	return decrypt[SmtpServer](key, s)
+}
+
 func (s SecureSmtpServer) GetCryptoParams() cryptostruct.CryptoParams {
 	return s.CryptoParams
 }
@@ -0,0 +1,278 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"reflect"
+	"sync"
+)
+
+// NewStore loads the registry file of the loader with the keyring.
+// A registry file which does not exist yet results in an empty store at revision 0, the file is created on the first Update.
+func NewStore(l Loader, k Keyring) (*Store, error) {
+	s := &Store{
+		loader:  l,
+		keyring: k,
+	}
+	if _, err := os.Stat(l.Path); errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Store holds a decrypted registry which is shared between goroutines.
+// The registry is read in View transactions and changed in Update transactions, which save the registry file.
+// Saves are compare-and-swap on the revision of the registry file, so changes by other writers are never overwritten.
+type Store struct {
+	loader  Loader
+	keyring Keyring
+
+	// Serializes Update and reload, so a reload never swaps in a registry file which was read before a concurrent Update saved it
+	writeMutex sync.Mutex
+
+	mutex    sync.RWMutex
+	registry Registry
+	sealed   []string
+	revision uint64
+
+	subscribersMutex sync.Mutex
+	subscribers      map[int]subscriber
+	nextSubscriber   int
+}
+
+// Reload replaces the registry with the contents of the registry file, such as after a revision conflict.
+// Subscribers are notified of the changes to the registry.
+// If the registry file cannot be loaded, for example because it was removed, the store keeps the previous registry.
+func (s *Store) Reload() error {
+	return s.reload(false)
+}
+
+// Revision returns the revision of the registry file the store is in sync with
+func (s *Store) Revision() uint64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.revision
+}
+
+// Sealed returns the names of the organizations which cannot be decrypted with the keyring of the store
+func (s *Store) Sealed() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return append([]string(nil), s.sealed...)
+}
+
+// Subscribe calls fn for every change to the registry, until unsubscribe is called.
+// Secrets in the before and after images of the events are redacted, SubscribeWithFilter can reveal them.
+func (s *Store) Subscribe(fn func(e Event)) (unsubscribe func()) {
+	return s.SubscribeWithFilter(EventFilter{}, fn)
+}
+
+// SubscribeWithFilter calls fn for every change to the registry which matches the filter, until unsubscribe is called.
+// Changes are published by Update and by reloading the registry file, such as by a Watcher.
+// Fn is called after the registry has been replaced and outside of any transaction, so it can use View to read the new registry.
+func (s *Store) SubscribeWithFilter(f EventFilter, fn func(e Event)) (unsubscribe func()) {
+	s.subscribersMutex.Lock()
+	defer s.subscribersMutex.Unlock()
+
+	if s.subscribers == nil {
+		s.subscribers = make(map[int]subscriber)
+	}
+	id := s.nextSubscriber
+	s.subscribers[id] = subscriber{filter: f, fn: fn}
+	s.nextSubscriber++
+
+	return func() {
+		s.subscribersMutex.Lock()
+		defer s.subscribersMutex.Unlock()
+		delete(s.subscribers, id)
+	}
+}
+
+// Update runs fn on a copy of the registry and saves the result if fn succeeds.
+// If the registry file was changed by another writer since the store was loaded, nothing is changed
+// and an error matching ErrRevisionConflict is returned, Reload brings the store back in sync.
+// Updates are serialized, View transactions keep reading the previous registry until the registry file is saved.
+// Subscribers are notified of the changes once the registry file is saved.
+// Organizations which are sealed for the keyring of the store cannot be added, as that would overwrite them.
+func (s *Store) Update(fn func(r *Registry) error) error {
+	events, err := s.update(fn)
+	if err != nil {
+		return err
+	}
+	s.publish(events)
+	return nil
+}
+
+// View runs fn on the registry, multiple View transactions can run at the same time.
+// The registry is shared, so fn must not modify it, or keep references to its collections after it returns.
+func (s *Store) View(fn func(r Registry) error) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return fn(s.registry)
+}
+
+func (s *Store) publish(events []Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	s.subscribersMutex.Lock()
+	subscribers := make([]subscriber, 0, len(s.subscribers))
+	for id := 0; id < s.nextSubscriber; id++ {
+		if sub, found := s.subscribers[id]; found {
+			subscribers = append(subscribers, sub)
+		}
+	}
+	s.subscribersMutex.Unlock()
+
+	for _, e := range events {
+		for _, sub := range subscribers {
+			if !sub.filter.Matches(e) {
+				continue
+			}
+			if sub.filter.Reveal {
+				sub.fn(e.revealed())
+			} else {
+				sub.fn(e.redacted())
+			}
+		}
+	}
+}
+
+// reload swaps in the registry file and notifies the subscribers once the store is unlocked
+func (s *Store) reload(validate bool) error {
+	events, err := s.swap(validate)
+	if err != nil {
+		return err
+	}
+	s.publish(events)
+	return nil
+}
+
+// swap loads and decrypts the registry file and swaps it in, a registry which does not validate is rejected if requested.
+// A registry file at a lower revision than the store, such as after a git checkout or revert, replaces the registry like any other change.
+func (s *Store) swap(validate bool) ([]Event, error) {
+	var (
+		err    error
+		secure SecureRegistry
+		r      Registry
+		sealed []string
+	)
+
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+
+	if secure, err = s.loader.LoadSecure(); err != nil {
+		return nil, err
+	}
+	if r, sealed, err = secure.DecryptWithKeyring(s.keyring); err != nil {
+		return nil, fmt.Errorf("could not decrypt registry file %s: %w", s.loader.Path, err)
+	}
+	if validate {
+		if err = r.Validate(); err != nil {
+			return nil, fmt.Errorf("could not reload registry file %s, the registry is not valid:\n%w", s.loader.Path, err)
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	previous := s.registry
+	s.registry = r
+	s.sealed = sealed
+	s.revision = secure.Revision
+	return newEvents(Diff(previous, r), previous, r, secure.Revision), nil
+}
+
+// update runs fn on a copy of the registry and saves the result, it returns the events for the changes.
+// Only writeMutex is held while saving, so View transactions are not blocked by key derivation or waiting for the file lock.
+func (s *Store) update(fn func(r *Registry) error) ([]Event, error) {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+
+	// The registry, sealed organizations and revision only change while holding writeMutex
+	s.mutex.RLock()
+	previous := s.registry
+	sealed := s.sealed
+	revision := s.revision
+	r := cloneValue(reflect.ValueOf(previous)).Interface().(Registry)
+	s.mutex.RUnlock()
+
+	err := fn(&r)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkSealedNames(r, sealed); err != nil {
+		return nil, err
+	}
+	if revision, err = s.loader.SaveIfRevision(s.keyring, r, revision); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	s.registry = r
+	s.revision = revision
+	s.mutex.Unlock()
+	return newEvents(Diff(previous, r), previous, r, revision), nil
+}
+
+type subscriber struct {
+	filter EventFilter
+	fn     func(e Event)
+}
+
+// cloneValue returns a deep copy of v, so collections and maps of the copy can be modified without affecting v
+func cloneValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Struct:
+		output := reflect.New(v.Type()).Elem()
+		output.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				output.Field(i).Set(cloneValue(v.Field(i)))
+			}
+		}
+		return output
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		output := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			output.Index(i).Set(cloneValue(v.Index(i)))
+		}
+		return output
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		output := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			output.SetMapIndex(iter.Key(), cloneValue(iter.Value()))
+		}
+		return output
+	}
+	return v
+}
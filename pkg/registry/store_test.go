@@ -0,0 +1,344 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStoreReloadLowerRevision(t *testing.T) {
+	l, k := newTestLoader(t)
+	if err := l.SaveWithKeyring(k, newTestRegistry("a")); err != nil {
+		t.Fatalf("SaveWithKeyring returned error: %v", err)
+	}
+	data, err := os.ReadFile(l.Path)
+	if err != nil {
+		t.Fatalf("could not read registry file: %v", err)
+	}
+
+	s, err := NewStore(l, k)
+	if err != nil {
+		t.Fatalf("NewStore returned error: %v", err)
+	}
+	if err = s.Update(func(r *Registry) error {
+		r.Organizations = append(r.Organizations, NewOrganization("b"))
+		return nil
+	}); err != nil {
+		t.Fatalf("Update returned error: %v", err)
+	}
+	events := collectEvents(s)
+
+	// Restore the first revision, as a git checkout of an older commit would
+	if err = os.WriteFile(l.Path, data, DefaultFileMode); err != nil {
+		t.Fatalf("could not write registry file: %v", err)
+	}
+	if err = s.Reload(); err != nil {
+		t.Fatalf("Reload returned error: %v", err)
+	}
+
+	if revision := s.Revision(); revision != 1 {
+		t.Errorf("Revision returned %d after reloading, want 1", revision)
+	}
+	if names := storeOrganizationNames(s); !slices.Equal(names, []string{"a"}) {
+		t.Errorf("store holds organizations %v after reloading, want [a]", names)
+	}
+	if got := events(); len(got) != 1 || got[0].String() != "organization b removed" {
+		t.Errorf("Reload published %v, want [organization b removed]", got)
+	}
+}
+
+func TestStoreReloadMissingFile(t *testing.T) {
+	l, k := newTestLoader(t)
+	if err := l.SaveWithKeyring(k, newTestRegistry("a")); err != nil {
+		t.Fatalf("SaveWithKeyring returned error: %v", err)
+	}
+	s, err := NewStore(l, k)
+	if err != nil {
+		t.Fatalf("NewStore returned error: %v", err)
+	}
+	events := collectEvents(s)
+
+	if err = os.Remove(l.Path); err != nil {
+		t.Fatalf("could not remove registry file: %v", err)
+	}
+	if err = s.Reload(); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Reload returned %v, want %v", err, fs.ErrNotExist)
+	}
+	if revision := s.Revision(); revision != 1 {
+		t.Errorf("Revision returned %d after a failed reload, want 1", revision)
+	}
+	if names := storeOrganizationNames(s); !slices.Equal(names, []string{"a"}) {
+		t.Errorf("store holds organizations %v after a failed reload, want [a]", names)
+	}
+	if got := events(); len(got) != 0 {
+		t.Errorf("Reload published %v for a missing registry file", got)
+	}
+}
+
+func TestNewStoreMissingFile(t *testing.T) {
+	l, k := newTestLoader(t)
+	s, err := NewStore(l, k)
+	if err != nil {
+		t.Fatalf("NewStore returned error: %v", err)
+	}
+	if revision := s.Revision(); revision != 0 {
+		t.Errorf("Revision returned %d, want 0", revision)
+	}
+	if err = s.Update(func(r *Registry) error {
+		r.Organizations = append(r.Organizations, NewOrganization("a"))
+		return nil
+	}); err != nil {
+		t.Fatalf("Update returned error: %v", err)
+	}
+	if revision := s.Revision(); revision != 1 {
+		t.Errorf("Revision returned %d after the first Update, want 1", revision)
+	}
+}
+
+func TestWatcherMissingFile(t *testing.T) {
+	l, k := newTestLoader(t)
+	if err := l.SaveWithKeyring(k, newTestRegistry("a")); err != nil {
+		t.Fatalf("SaveWithKeyring returned error: %v", err)
+	}
+	s, err := NewStore(l, k)
+	if err != nil {
+		t.Fatalf("NewStore returned error: %v", err)
+	}
+	events := collectEvents(s)
+
+	errs := make(chan error, 10)
+	w := NewWatcher(s)
+	w.PollInterval = 50 * time.Millisecond
+	w.OnError = func(err error) { errs <- err }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = w.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Give the watcher time to start watching the directory
+	time.Sleep(200 * time.Millisecond)
+	if err = os.Remove(l.Path); err != nil {
+		t.Fatalf("could not remove registry file: %v", err)
+	}
+
+	select {
+	case err = <-errs:
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("OnError was called with %v, want %v", err, fs.ErrNotExist)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("OnError was not called after the registry file was removed")
+	}
+	if names := storeOrganizationNames(s); !slices.Equal(names, []string{"a"}) {
+		t.Errorf("store holds organizations %v after the registry file was removed, want [a]", names)
+	}
+	if got := events(); len(got) != 0 {
+		t.Errorf("watcher published %v after the registry file was removed", got)
+	}
+}
+
+func TestStoreUpdateRevisionConflict(t *testing.T) {
+	l, k := newTestLoader(t)
+	if err := l.SaveWithKeyring(k, newTestRegistry("a")); err != nil {
+		t.Fatalf("SaveWithKeyring returned error: %v", err)
+	}
+	first, err := NewStore(l, k)
+	if err != nil {
+		t.Fatalf("NewStore returned error: %v", err)
+	}
+	second, err := NewStore(l, k)
+	if err != nil {
+		t.Fatalf("NewStore returned error: %v", err)
+	}
+
+	add := func(name string) func(r *Registry) error {
+		return func(r *Registry) error {
+			r.Organizations = append(r.Organizations, NewOrganization(name))
+			return nil
+		}
+	}
+	if err = first.Update(add("b")); err != nil {
+		t.Fatalf("Update returned error: %v", err)
+	}
+
+	var conflict RevisionConflictError
+	if err = second.Update(add("c")); !errors.Is(err, ErrRevisionConflict) || !errors.As(err, &conflict) {
+		t.Fatalf("Update of a stale store returned %v, want %v", err, ErrRevisionConflict)
+	}
+	if conflict.Expected != 1 || conflict.Actual != 2 {
+		t.Errorf("Update reported a conflict between revisions %d and %d, want 1 and 2", conflict.Expected, conflict.Actual)
+	}
+	if names := storeOrganizationNames(second); !slices.Equal(names, []string{"a"}) {
+		t.Errorf("stale store holds organizations %v after a conflict, want [a]", names)
+	}
+	if r, err := l.Load("test key"); err != nil || !slices.Equal(r.GetOrganizationNames(), []string{"a", "b"}) {
+		t.Errorf("registry file holds organizations %v (%v) after a conflict, want [a b]", r.GetOrganizationNames(), err)
+	}
+
+	if err = second.Reload(); err != nil {
+		t.Fatalf("Reload returned error: %v", err)
+	}
+	if err = second.Update(add("c")); err != nil {
+		t.Fatalf("Update after Reload returned error: %v", err)
+	}
+	if revision := second.Revision(); revision != 3 {
+		t.Errorf("Revision returned %d, want 3", revision)
+	}
+}
+
+func TestStoreConcurrentUpdates(t *testing.T) {
+	l, k := newTestLoader(t)
+	s, err := NewStore(l, k)
+	if err != nil {
+		t.Fatalf("NewStore returned error: %v", err)
+	}
+
+	names := []string{"a", "b", "c", "d"}
+	errs := make(chan error, len(names))
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- s.Update(func(r *Registry) error {
+				r.Organizations = append(r.Organizations, NewOrganization(name))
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err = range errs {
+		if err != nil {
+			t.Errorf("Update returned error: %v", err)
+		}
+	}
+	got := storeOrganizationNames(s)
+	slices.Sort(got)
+	if !slices.Equal(got, names) {
+		t.Errorf("store holds organizations %v, want %v", got, names)
+	}
+	if revision := s.Revision(); revision != uint64(len(names)) {
+		t.Errorf("Revision returned %d, want %d", revision, len(names))
+	}
+}
+
+func TestStoreViewDuringUpdate(t *testing.T) {
+	l, k := newTestLoader(t)
+	l.LockTimeout = 10 * time.Second
+	s, err := NewStore(l, k)
+	if err != nil {
+		t.Fatalf("NewStore returned error: %v", err)
+	}
+
+	// Hold the lock on the registry file, so the Update has to wait for it while saving
+	lock, err := lockFile(l.Path, time.Second)
+	if err != nil {
+		t.Fatalf("could not lock registry file: %v", err)
+	}
+	updated := make(chan error, 1)
+	go func() {
+		updated <- s.Update(func(r *Registry) error {
+			r.Organizations = append(r.Organizations, NewOrganization("a"))
+			return nil
+		})
+	}()
+	time.Sleep(200 * time.Millisecond)
+
+	viewed := make(chan []string, 1)
+	go func() {
+		viewed <- storeOrganizationNames(s)
+	}()
+	select {
+	case names := <-viewed:
+		if len(names) != 0 {
+			t.Errorf("View returned organizations %v before the Update was saved", names)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("View was blocked by an Update waiting for the lock on the registry file")
+	}
+
+	if err = lock.Unlock(); err != nil {
+		t.Fatalf("could not unlock registry file: %v", err)
+	}
+	if err = <-updated; err != nil {
+		t.Fatalf("Update returned error: %v", err)
+	}
+	if names := storeOrganizationNames(s); !slices.Equal(names, []string{"a"}) {
+		t.Errorf("store holds organizations %v after the Update, want [a]", names)
+	}
+}
+
+func newTestLoader(t *testing.T) (Loader, Keyring) {
+	t.Helper()
+	l := NewLoader(filepath.Join(t.TempDir(), "registry.yaml"))
+	l.LockTimeout = time.Second
+	return l, NewKeyring("test key")
+}
+
+func newTestRegistry(names ...string) Registry {
+	r := Registry{}
+	for _, name := range names {
+		r.Organizations = append(r.Organizations, NewOrganization(name))
+	}
+	return r
+}
+
+// collectEvents subscribes to the store, the returned function returns the events published so far
+func collectEvents(s *Store) func() []Event {
+	var (
+		mutex  sync.Mutex
+		events []Event
+	)
+	s.Subscribe(func(e Event) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		events = append(events, e)
+	})
+	return func() []Event {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return slices.Clone(events)
+	}
+}
+
+func storeOrganizationNames(s *Store) []string {
+	var names []string
+	_ = s.View(func(r Registry) error {
+		for _, o := range r.Organizations {
+			names = append(names, o.Name)
+		}
+		return nil
+	})
+	return names
+}
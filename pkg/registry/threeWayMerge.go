@@ -0,0 +1,265 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const (
+	ConflictReasonModified        = "modified on both sides"
+	ConflictReasonModifiedDeleted = "modified in ours, deleted in theirs"
+	ConflictReasonDeletedModified = "deleted in ours, modified in theirs"
+)
+
+// Conflict is a path which was changed differently in ours and theirs.
+// Secret values are never included.
+type Conflict struct {
+	Path   string `json:"path" yaml:"path"`
+	Reason string `json:"reason" yaml:"reason"`
+	Secret bool   `json:"secret,omitempty" yaml:"secret,omitempty"`
+	Base   any    `json:"base,omitempty" yaml:"base,omitempty"`
+	Ours   any    `json:"ours,omitempty" yaml:"ours,omitempty"`
+	Theirs any    `json:"theirs,omitempty" yaml:"theirs,omitempty"`
+}
+
+func (c Conflict) String() string {
+	if c.Secret || c.Reason != ConflictReasonModified {
+		return fmt.Sprintf("%s: %s", c.Path, c.Reason)
+	}
+	return fmt.Sprintf("%s: %s, base %s, ours %s, theirs %s", c.Path, c.Reason, formatChangeValue(c.Base), formatChangeValue(c.Ours), formatChangeValue(c.Theirs))
+}
+
+type Conflicts []Conflict
+
+func (c Conflicts) Error() string {
+	lines := make([]string, len(c))
+	for i, conflict := range c {
+		lines[i] = conflict.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// MergeThreeWay merges the changes from base to ours and from base to theirs.
+// Items are matched by name, like Diff, so changes to different items or fields never conflict.
+// For conflicting paths the result holds the value of ours and the conflict is reported.
+func MergeThreeWay(base Registry, ours Registry, theirs Registry) (Registry, Conflicts) {
+	conflicts := make(Conflicts, 0)
+	organizations := threeWayValue(nil, reflect.ValueOf(base.Organizations), reflect.ValueOf(ours.Organizations), reflect.ValueOf(theirs.Organizations), false, &conflicts)
+	return Registry{Organizations: organizations.Interface().([]Organization)}, conflicts
+}
+
+// MergeThreeWayFiles decrypts three registry files with the keyring, merges them and writes the result to ours.
+// Conflicts are returned after the result has been written.
+func MergeThreeWayFiles(base string, ours string, theirs string, k Keyring) (Conflicts, error) {
+	return NewLoader(ours).MergeThreeWay(base, theirs, k)
+}
+
+// MergeThreeWay merges the registry files base and theirs into the registry file of the loader, which is ours.
+// The result is written as a revision above the revisions of all three files, so stores which loaded any of them reload the result.
+// Conflicts are returned after the result has been written.
+func (l Loader) MergeThreeWay(base string, theirs string, k Keyring) (Conflicts, error) {
+	var (
+		err        error
+		registries [3]Registry
+		revision   uint64
+		s          SecureRegistry
+	)
+
+	for i, path := range []string{base, l.Path, theirs} {
+		if s, err = NewLoader(path).LoadSecure(); err != nil {
+			return nil, err
+		}
+		if registries[i], err = decryptAll(s, k); err != nil {
+			return nil, fmt.Errorf("could not decrypt registry file %s: %w", path, err)
+		}
+		revision = max(revision, s.Revision)
+	}
+
+	merged, conflicts := MergeThreeWay(registries[0], registries[1], registries[2])
+	err = l.withLock(func() error {
+		existing, err := l.loadExisting()
+		if err != nil {
+			return err
+		}
+		_, err = l.saveRevision(k, merged, existing, max(revision, existing.Revision)+1)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conflicts, nil
+}
+
+// threeWayValue merges values of the same type, base is invalid for items which were added in ours and theirs
+func threeWayValue(path []string, base reflect.Value, ours reflect.Value, theirs reflect.Value, secret bool, conflicts *Conflicts) reflect.Value {
+	if !base.IsValid() {
+		base = reflect.Zero(ours.Type())
+	}
+
+	switch ours.Kind() {
+	case reflect.Struct:
+		output := reflect.New(ours.Type()).Elem()
+		inline := inlinePathFields[ours.Type()]
+		for i := 0; i < ours.NumField(); i++ {
+			field := ours.Type().Field(i)
+			name := pathFieldName(field)
+			if name == "" {
+				// CryptoParams are not merged
+				continue
+			}
+			fieldPath := append(path[:len(path):len(path)], name)
+			if field.Name == inline {
+				fieldPath = path
+			}
+			output.Field(i).Set(threeWayValue(fieldPath, base.Field(i), ours.Field(i), theirs.Field(i), field.Tag.Get("secure") == "true", conflicts))
+		}
+		return output
+	case reflect.Slice:
+		if ours.Type().Elem().Kind() == reflect.Struct {
+			return threeWayCollection(path, base, ours, theirs, conflicts)
+		}
+	case reflect.Map:
+		return threeWayMap(path, base, ours, theirs, secret, conflicts)
+	}
+
+	switch {
+	case isEqualValue(ours, theirs), isEqualValue(base, theirs):
+		return ours
+	case isEqualValue(base, ours):
+		return theirs
+	}
+	*conflicts = append(*conflicts, newConflict(path, ConflictReasonModified, base, ours, theirs, secret))
+	return ours
+}
+
+func threeWayCollection(path []string, base reflect.Value, ours reflect.Value, theirs reflect.Value, conflicts *Conflicts) reflect.Value {
+	baseItems := indexItems(base)
+	oursItems := indexItems(ours)
+	theirsItems := indexItems(theirs)
+
+	// Items keep the order of ours, items which were only added in theirs are appended
+	names := make([]string, 0, ours.Len()+theirs.Len())
+	for i := 0; i < ours.Len(); i++ {
+		names = append(names, itemNameField(ours.Index(i)).String())
+	}
+	for i := 0; i < theirs.Len(); i++ {
+		if name := itemNameField(theirs.Index(i)).String(); !oursItems[name].IsValid() {
+			names = append(names, name)
+		}
+	}
+
+	output := reflect.MakeSlice(ours.Type(), 0, len(names))
+	for _, name := range names {
+		itemPath := append(path[:len(path):len(path)], name)
+		b, o, t := baseItems[name], oursItems[name], theirsItems[name]
+		switch {
+		case o.IsValid() && t.IsValid():
+			// Items added on both sides are merged field by field, as if they were empty in base
+			output = reflect.Append(output, threeWayValue(itemPath, b, o, t, false, conflicts))
+		case o.IsValid():
+			if !b.IsValid() {
+				output = reflect.Append(output, o)
+			} else if !isEqualValue(b, o) {
+				*conflicts = append(*conflicts, Conflict{Path: JoinPath(itemPath...), Reason: ConflictReasonModifiedDeleted})
+				output = reflect.Append(output, o)
+			}
+		case t.IsValid():
+			if !b.IsValid() {
+				output = reflect.Append(output, t)
+			} else if !isEqualValue(b, t) {
+				*conflicts = append(*conflicts, Conflict{Path: JoinPath(itemPath...), Reason: ConflictReasonDeletedModified})
+			}
+		}
+	}
+	return output
+}
+
+func threeWayMap(path []string, base reflect.Value, ours reflect.Value, theirs reflect.Value, secret bool, conflicts *Conflicts) reflect.Value {
+	keys := make(map[string]bool)
+	for _, m := range []reflect.Value{base, ours, theirs} {
+		for _, key := range m.MapKeys() {
+			keys[key.String()] = true
+		}
+	}
+
+	output := reflect.MakeMapWithSize(ours.Type(), len(keys))
+	for _, key := range sortedKeys(keys) {
+		k := reflect.ValueOf(key)
+		b, o, t := base.MapIndex(k), ours.MapIndex(k), theirs.MapIndex(k)
+
+		var value reflect.Value
+		switch {
+		case isEqualValue(o, t), isEqualValue(b, t):
+			value = o
+		case isEqualValue(b, o):
+			value = t
+		default:
+			*conflicts = append(*conflicts, newConflict(append(path[:len(path):len(path)], key), ConflictReasonModified, b, o, t, secret))
+			value = o
+		}
+		if value.IsValid() {
+			output.SetMapIndex(k, value)
+		}
+	}
+	if output.Len() == 0 && ours.IsNil() {
+		return ours
+	}
+	return output
+}
+
+func indexItems(collection reflect.Value) map[string]reflect.Value {
+	output := make(map[string]reflect.Value, collection.Len())
+	for i := 0; i < collection.Len(); i++ {
+		output[itemNameField(collection.Index(i)).String()] = collection.Index(i)
+	}
+	return output
+}
+
+// isEqualValue compares values like Diff does, so nil and empty collections are equal.
+// Invalid values, for missing items and keys, are only equal to each other.
+func isEqualValue(a reflect.Value, b reflect.Value) bool {
+	if !a.IsValid() || !b.IsValid() {
+		return a.IsValid() == b.IsValid()
+	}
+	changes := make(Changes, 0)
+	diffValue(nil, a, b, false, &changes)
+	return len(changes) == 0
+}
+
+func newConflict(path []string, reason string, base reflect.Value, ours reflect.Value, theirs reflect.Value, secret bool) Conflict {
+	output := Conflict{
+		Path:   JoinPath(path...),
+		Reason: reason,
+		Secret: secret,
+	}
+	if secret {
+		return output
+	}
+	if base.IsValid() {
+		output.Base = base.Interface()
+	}
+	if ours.IsValid() {
+		output.Ours = ours.Interface()
+	}
+	if theirs.IsValid() {
+		output.Theirs = theirs.Interface()
+	}
+	return output
+}
@@ -0,0 +1,186 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+)
+
+// ValidationError describes a single problem in a registry.
+// Path addresses the offending value, such as organizations[acme]/machines/netscaler/adc/environments[prod]/nodes[0].address.
+// Items in a collection are addressed by name, or by index if they do not have a name.
+type ValidationError struct {
+	Path    string `json:"path" yaml:"path"`
+	Message string `json:"message" yaml:"message"`
+}
+
+func (e ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ValidationErrors holds all problems found while validating a registry
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+func (e *ValidationErrors) add(path string, format string, args ...any) {
+	*e = append(*e, ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// errorOrNil avoids returning a nil ValidationErrors as a non-nil error
+func (e ValidationErrors) errorOrNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+func childPath(path string, child string) string {
+	if path == "" {
+		return child
+	}
+	return path + "/" + child
+}
+
+func fieldPath(path string, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+func itemPath(path string, collection string, name string, index int) string {
+	if name == "" {
+		return childPath(path, fmt.Sprintf("%s[%d]", collection, index))
+	}
+	return childPath(path, fmt.Sprintf("%s[%s]", collection, name))
+}
+
+// validateCollection checks that all items in a collection have a unique, non-empty name
+func validateCollection[T namedItem](path string, collection string, field string, items []T) ValidationErrors {
+	var errs ValidationErrors
+
+	seen := make(map[string]bool, len(items))
+	for i, item := range items {
+		name := item.itemName()
+		if name == "" {
+			errs.add(fieldPath(itemPath(path, collection, "", i), field), "%s is required", field)
+			continue
+		}
+		if seen[name] {
+			errs.add(itemPath(path, collection, name, i), "duplicate %s %s", field, name)
+		}
+		seen[name] = true
+	}
+	return errs
+}
+
+// isValidHost returns true if s is an IP address or a valid DNS host name
+func isValidHost(s string) bool {
+	if net.ParseIP(s) != nil {
+		return true
+	}
+
+	s = strings.TrimSuffix(s, ".")
+	if len(s) == 0 || len(s) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(s, ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// validateLabels checks labels and annotations, using the same rules for keys and label values as Kubernetes
+func validateLabels(path string, labels map[string]string, annotations map[string]string) ValidationErrors {
+	var errs ValidationErrors
+
+	for _, key := range sortedKeys(labels) {
+		if !isValidLabelKey(key) {
+			errs.add(fieldPath(path, fmt.Sprintf("labels[%s]", key)), "invalid label key %q", key)
+		}
+		if !isValidLabelName(labels[key], true) {
+			errs.add(fieldPath(path, fmt.Sprintf("labels[%s]", key)), "invalid label value %q", labels[key])
+		}
+	}
+	for _, key := range sortedKeys(annotations) {
+		if !isValidLabelKey(key) {
+			errs.add(fieldPath(path, fmt.Sprintf("annotations[%s]", key)), "invalid annotation key %q", key)
+		}
+	}
+	return errs
+}
+
+// isValidLabelKey returns true for keys with an optional dns prefix and a name, such as example.com/region
+func isValidLabelKey(key string) bool {
+	prefix, name, hasPrefix := strings.Cut(key, "/")
+	if !hasPrefix {
+		return isValidLabelName(key, false)
+	}
+	return isValidHost(prefix) && net.ParseIP(prefix) == nil && isValidLabelName(name, false)
+}
+
+// isValidLabelName returns true for names of at most 63 alphanumeric characters, dashes, underscores and dots,
+// starting and ending with an alphanumeric character
+func isValidLabelName(name string, allowEmpty bool) bool {
+	if name == "" {
+		return allowEmpty
+	}
+	if len(name) > 63 {
+		return false
+	}
+	isAlphanumeric := func(c byte) bool {
+		return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+	}
+	if !isAlphanumeric(name[0]) || !isAlphanumeric(name[len(name)-1]) {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isAlphanumeric(name[i]) && name[i] != '-' && name[i] != '_' && name[i] != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateDoesNotReportSecrets(t *testing.T) {
+	const secret = "s3cr3t value"
+
+	tests := map[string]struct {
+		item interface{ Validate() error }
+		path string
+	}{
+		"node address":     {item: NetScalerAdcNode{Name: "node", Address: secret}, path: "address"},
+		"smtp address":     {item: SmtpServer{Name: "smtp", Address: secret}, path: "address"},
+		"smtp port":        {item: SmtpServer{Name: "smtp", Address: "smtp.example.com", Port: secret}, path: "port"},
+		"acme user email":  {item: AcmeUser{Name: "user", Email: secret}, path: "email"},
+		"acme service url": {item: AcmeService{Name: "service", Url: secret}, path: "url"},
+	}
+	for name, tt := range tests {
+		var problems ValidationErrors
+
+		err := tt.item.Validate()
+		if !errors.As(err, &problems) {
+			t.Fatalf("%s: Validate returned %v, want ValidationErrors", name, err)
+		}
+		if len(problems) != 1 || problems[0].Path != tt.path {
+			t.Errorf("%s: Validate returned %v, want a single problem for %s", name, problems, tt.path)
+		}
+		if strings.Contains(err.Error(), secret) {
+			t.Errorf("%s: Validate reported the secret value: %v", name, err)
+		}
+	}
+}
+
+func TestValidateRegistryPaths(t *testing.T) {
+	var problems ValidationErrors
+
+	environment := NetScalerAdcEnvironment{Name: "prod", Nodes: []NetScalerAdcNode{{Address: "not a host"}}}
+	o := NewOrganization("acme")
+	o.Registry.Machines.NetScaler.Adc.Environments = []NetScalerAdcEnvironment{environment}
+	r := Registry{Organizations: []Organization{o}}
+
+	if err := r.Validate(); !errors.As(err, &problems) {
+		t.Fatalf("Validate returned %v, want ValidationErrors", err)
+	}
+	want := "organizations[acme]/machines/netscaler/adc/environments[prod]/nodes[0].address"
+	for _, p := range problems {
+		if p.Path == want {
+			return
+		}
+	}
+	t.Errorf("Validate returned %v, want a problem for %s", problems, want)
+}
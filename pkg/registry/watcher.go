@@ -0,0 +1,134 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package registry
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	DefaultPollInterval = 2 * time.Second
+
+	// Saving a registry file results in several file system events, which are handled as a single change
+	watchSettleDelay = 100 * time.Millisecond
+)
+
+func NewWatcher(s *Store) *Watcher {
+	return &Watcher{
+		PollInterval: DefaultPollInterval,
+		store:        s,
+	}
+}
+
+// Watcher reloads a Store when its registry file changes, so long-running processes pick up changes without a restart.
+// The changed registry file is decrypted and validated before it replaces the registry of the store,
+// subscribers of the store are notified with an event for every changed item.
+type Watcher struct {
+	PollInterval time.Duration   // Interval to check the registry file for changes, if file system notifications are not available
+	OnError      func(err error) // Called when a changed registry file cannot be loaded, the store keeps the previous registry
+
+	store *Store
+}
+
+// Run watches the registry file until ctx is done, it then returns the error of ctx.
+// File system notifications are used where available, the registry file is polled otherwise.
+func (w *Watcher) Run(ctx context.Context) error {
+	notifications, err := fsnotify.NewWatcher()
+	if err != nil {
+		return w.poll(ctx)
+	}
+	defer notifications.Close()
+
+	// Registry files are replaced on save, so the directory is watched instead of the file itself
+	if err = notifications.Add(filepath.Dir(w.store.loader.Path)); err != nil {
+		return w.poll(ctx)
+	}
+	return w.watch(ctx, notifications)
+}
+
+func (w *Watcher) poll(ctx context.Context) error {
+	interval := w.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	previous, _ := os.Stat(w.store.loader.Path)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			current, _ := os.Stat(w.store.loader.Path)
+			if isSameFileVersion(previous, current) {
+				continue
+			}
+			previous = current
+			w.reload()
+		}
+	}
+}
+
+func (w *Watcher) reload() {
+	if err := w.store.reload(true); err != nil && w.OnError != nil {
+		w.OnError(err)
+	}
+}
+
+func (w *Watcher) watch(ctx context.Context, notifications *fsnotify.Watcher) error {
+	path := filepath.Clean(w.store.loader.Path)
+	settle := time.NewTimer(watchSettleDelay)
+	settle.Stop()
+	defer settle.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-notifications.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Clean(event.Name) == path && event.Op != fsnotify.Chmod {
+				settle.Reset(watchSettleDelay)
+			}
+		case err, ok := <-notifications.Errors:
+			if !ok {
+				return nil
+			}
+			if w.OnError != nil {
+				w.OnError(err)
+			}
+		case <-settle.C:
+			w.reload()
+		}
+	}
+}
+
+// isSameFileVersion reports whether two results of os.Stat refer to the same contents of a file
+func isSameFileVersion(a os.FileInfo, b os.FileInfo) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return os.SameFile(a, b) && a.ModTime().Equal(b.ModTime()) && a.Size() == b.Size()
+}